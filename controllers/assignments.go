@@ -0,0 +1,695 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Assignment statuses. A territory is checked out to a team, optionally
+// marked in progress once work starts, and closed by being returned
+// unfinished, completed, or reassigned to another team.
+const (
+	AssignmentCheckedOut = "checked_out"
+	AssignmentInProgress = "in_progress"
+	AssignmentReturned   = "returned"
+	AssignmentCompleted  = "completed"
+	AssignmentReassigned = "reassigned"
+)
+
+// openAssignment is the condition for an open assignment in team_assignments
+// aliased ta.
+const openAssignment = "ta.status IN ('checked_out', 'in_progress')"
+
+// assignmentTransitions lists the statuses each status can change to. A
+// closed assignment can be checked out to the same team again.
+var assignmentTransitions = map[string][]string{
+	AssignmentCheckedOut: {AssignmentInProgress, AssignmentReturned, AssignmentCompleted, AssignmentReassigned},
+	AssignmentInProgress: {AssignmentReturned, AssignmentCompleted, AssignmentReassigned},
+	AssignmentReturned:   {AssignmentCheckedOut},
+	AssignmentCompleted:  {AssignmentCheckedOut},
+	AssignmentReassigned: {AssignmentCheckedOut},
+}
+
+func canTransition(from, to string) bool {
+	for _, status := range assignmentTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Actions recorded in the assignment history. Most follow from the status an
+// assignment moves to; inherited and replaced record the assignments a split
+// or merge hands from one location to another.
+const (
+	ActionAssigned    = "assigned"
+	ActionStarted     = "started"
+	ActionReturned    = "returned"
+	ActionCompleted   = "completed"
+	ActionTransferred = "transferred"
+	ActionInherited   = "inherited"
+	ActionReplaced    = "replaced"
+)
+
+func assignmentAction(to string) string {
+	switch to {
+	case AssignmentCheckedOut:
+		return ActionAssigned
+	case AssignmentInProgress:
+		return ActionStarted
+	case AssignmentReassigned:
+		return ActionTransferred
+	}
+	return to
+}
+
+// eventSnapshot selects the team and location names kept with an event
+// recorded from team_assignments aliased ta.
+const eventSnapshot = `COALESCE((SELECT name FROM teams WHERE id = ta.team_id), ''),
+               COALESCE((SELECT name FROM locations WHERE id = ta.location_id), '')`
+
+// assignmentChange says why and by whom an assignment changed. Both are
+// free text and may be empty.
+type assignmentChange struct {
+	Note  string
+	Actor string
+}
+
+// assignmentRow is the part of an assignment that status changes need.
+type assignmentRow struct {
+	ID         int    `db:"id"`
+	TeamID     int    `db:"team_id"`
+	LocationID int    `db:"location_id"`
+	Status     string `db:"status"`
+}
+
+// defaultDueDate is today plus the configured loan period.
+func defaultDueDate(q sqlx.Queryer) (string, error) {
+	days, err := settingInt(q, SettingLoanDays)
+	if err != nil {
+		return "", err
+	}
+	return time.Now().AddDate(0, 0, days).Format("2006-01-02"), nil
+}
+
+// recordAssignmentEvent adds a status change to the assignment history. from
+// is empty when the assignment has just been created.
+func recordAssignmentEvent(tx *sqlx.Tx, a assignmentRow, from, to string, change assignmentChange) error {
+	var fromStatus *string
+	if from != "" {
+		fromStatus = &from
+	}
+	_, err := tx.Exec(`
+        INSERT INTO assignment_events (assignment_id, team_id, location_id, from_status, to_status,
+                                       action, note, actor, team_name, location_name)
+        SELECT ?, ?, ?, ?, ?, ?, ?, ?,
+               COALESCE((SELECT name FROM teams WHERE id = ?), ''),
+               COALESCE((SELECT name FROM locations WHERE id = ?), '')`,
+		a.ID, a.TeamID, a.LocationID, fromStatus, to, assignmentAction(to), change.Note, change.Actor,
+		a.TeamID, a.LocationID)
+	if err != nil {
+		return fmt.Errorf("failed to record assignment event: %v", err)
+	}
+	return nil
+}
+
+// transitionAssignment moves an assignment to a new status, which the caller
+// has checked is allowed, and records the change. Checking out again starts
+// a new loan, due on dueDate or after the default loan period.
+func transitionAssignment(tx *sqlx.Tx, a assignmentRow, to, dueDate string, change assignmentChange) error {
+	var query string
+	var args []interface{}
+	switch to {
+	case AssignmentCheckedOut:
+		if dueDate == "" {
+			var err error
+			if dueDate, err = defaultDueDate(tx); err != nil {
+				return err
+			}
+		}
+		query = `is_completed = FALSE, assigned_date = CURRENT_TIMESTAMP, due_date = ?,
+                 completed_date = NULL, returned_date = NULL`
+		args = append(args, dueDate)
+	case AssignmentInProgress:
+		query = "is_completed = FALSE"
+	case AssignmentCompleted:
+		query = "is_completed = TRUE, completed_date = CURRENT_TIMESTAMP"
+	default:
+		query = "is_completed = FALSE, returned_date = CURRENT_TIMESTAMP"
+	}
+
+	args = append([]interface{}{to}, append(args, a.ID)...)
+	if _, err := tx.Exec("UPDATE team_assignments SET status = ?, "+query+" WHERE id = ?", args...); err != nil {
+		return fmt.Errorf("failed to update assignment %d: %v", a.ID, err)
+	}
+	return recordAssignmentEvent(tx, a, a.Status, to, change)
+}
+
+// checkOutLocation checks a location out to a team, due on dueDate or after
+// the default loan period. A closed assignment of the same location to the
+// team is reopened; an open one is left as it is and false is returned.
+func checkOutLocation(tx *sqlx.Tx, teamID, locationID int, dueDate string, change assignmentChange) (bool, error) {
+	var a assignmentRow
+	err := tx.Get(&a, `
+        SELECT id, team_id, location_id, status FROM team_assignments
+        WHERE team_id = ? AND location_id = ?`, teamID, locationID)
+	if err == nil {
+		if !canTransition(a.Status, AssignmentCheckedOut) {
+			return false, nil
+		}
+		return true, transitionAssignment(tx, a, AssignmentCheckedOut, dueDate, change)
+	}
+	if err != sql.ErrNoRows {
+		return false, err
+	}
+
+	if dueDate == "" {
+		if dueDate, err = defaultDueDate(tx); err != nil {
+			return false, err
+		}
+	}
+	result, err := tx.Exec(`
+        INSERT INTO team_assignments (team_id, location_id, status, is_completed, assigned_date, due_date)
+        VALUES (?, ?, 'checked_out', FALSE, CURRENT_TIMESTAMP, ?)`, teamID, locationID, dueDate)
+	if err != nil {
+		return false, fmt.Errorf("failed to assign location %d: %v", locationID, err)
+	}
+	id, _ := result.LastInsertId()
+	a = assignmentRow{ID: int(id), TeamID: teamID, LocationID: locationID}
+	return true, recordAssignmentEvent(tx, a, "", AssignmentCheckedOut, change)
+}
+
+// AssignmentHolder is the team a location is checked out to.
+type AssignmentHolder struct {
+	LocationID   int       `json:"location_id" db:"location_id"`
+	LocationName string    `json:"location_name" db:"location_name"`
+	AssignmentID int       `json:"assignment_id" db:"assignment_id"`
+	TeamID       int       `json:"team_id" db:"team_id"`
+	TeamName     string    `json:"team_name" db:"team_name"`
+	Status       string    `json:"status" db:"status"`
+	AssignedDate time.Time `json:"assigned_date" db:"assigned_date"`
+	DueDate      *string   `json:"due_date" db:"due_date"`
+}
+
+// openHolders returns the teams holding any of the locations, ignoring
+// exceptTeam. A location is checked out to one team at a time.
+func openHolders(q sqlx.Queryer, locationIDs []int, exceptTeam int) ([]AssignmentHolder, error) {
+	holders := []AssignmentHolder{}
+	if len(locationIDs) == 0 {
+		return holders, nil
+	}
+	query, args, err := sqlx.In(`
+        SELECT
+            ta.location_id,
+            l.name as location_name,
+            ta.id as assignment_id,
+            ta.team_id,
+            t.name as team_name,
+            ta.status,
+            ta.assigned_date,
+            DATE(ta.due_date) as due_date
+        FROM team_assignments ta
+        JOIN teams t ON t.id = ta.team_id
+        JOIN locations l ON l.id = ta.location_id
+        WHERE `+openAssignment+` AND ta.location_id IN (?) AND ta.team_id != ?
+        ORDER BY ta.location_id`, locationIDs, exceptTeam)
+	if err != nil {
+		return nil, err
+	}
+	if err := sqlx.Select(q, &holders, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to fetch assignment holders: %v", err)
+	}
+	return holders, nil
+}
+
+// unavailableLocations returns the locations that can't be checked out to
+// the team because they don't exist or are retired, including those
+// replaced by a split or merge.
+func unavailableLocations(q sqlx.Queryer, locationIDs []int, teamID int) ([]AssignmentConflict, error) {
+	unavailable := []AssignmentConflict{}
+	if len(locationIDs) == 0 {
+		return unavailable, nil
+	}
+	query, args, err := sqlx.In(`
+        SELECT l.id, l.is_retired, EXISTS (SELECT 1 FROM location_lineage ll WHERE ll.parent_id = l.id) as is_replaced
+        FROM locations l WHERE l.id IN (?)`, locationIDs)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID         int  `db:"id"`
+		IsRetired  bool `db:"is_retired"`
+		IsReplaced bool `db:"is_replaced"`
+	}
+	if err := sqlx.Select(q, &rows, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to fetch locations: %v", err)
+	}
+	found := make(map[int]bool, len(rows))
+	for _, row := range rows {
+		found[row.ID] = true
+		switch {
+		case row.IsReplaced:
+			unavailable = append(unavailable, AssignmentConflict{row.ID, teamID, "location was split or merged; assign the locations that replaced it"})
+		case row.IsRetired:
+			unavailable = append(unavailable, AssignmentConflict{row.ID, teamID, "location is retired"})
+		}
+	}
+	for _, id := range locationIDs {
+		if !found[id] {
+			found[id] = true
+			unavailable = append(unavailable, AssignmentConflict{id, teamID, "location not found"})
+		}
+	}
+	return unavailable, nil
+}
+
+// TeamAssignment is a location assigned to a team.
+type TeamAssignment struct {
+	ID            int        `json:"id" db:"id"`
+	LocationID    int        `json:"location_id" db:"location_id"`
+	LocationName  string     `json:"location_name" db:"location_name"`
+	Status        string     `json:"status" db:"status"`
+	IsCompleted   bool       `json:"is_completed" db:"is_completed"`
+	AssignedDate  time.Time  `json:"assigned_date" db:"assigned_date"`
+	DueDate       *string    `json:"due_date" db:"due_date"`
+	CompletedDate *time.Time `json:"completed_date" db:"completed_date"`
+	ReturnedDate  *time.Time `json:"returned_date" db:"returned_date"`
+	IsOverdue     bool       `json:"is_overdue" db:"is_overdue"`
+}
+
+// GetTeamAssignments lists a team's assignments, open ones first in order of
+// due date.
+func GetTeamAssignments(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID := c.Param("id")
+		assignments := []TeamAssignment{}
+		err := db.Select(&assignments, `
+            SELECT
+                ta.id,
+                ta.location_id,
+                l.name as location_name,
+                ta.status,
+                ta.is_completed,
+                ta.assigned_date,
+                DATE(ta.due_date) as due_date,
+                ta.completed_date,
+                ta.returned_date,
+                `+openAssignment+` AND DATE(ta.due_date) < ? as is_overdue
+            FROM team_assignments ta
+            JOIN locations l ON ta.location_id = l.id
+            WHERE ta.team_id = ?
+            ORDER BY NOT (`+openAssignment+`), ta.due_date IS NULL, ta.due_date, l.name`, campaignDate(), teamID)
+		if err != nil {
+			log.Printf("Error fetching assignments of team %s: %v", teamID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignments"})
+			return
+		}
+
+		c.JSON(http.StatusOK, assignments)
+	}
+}
+
+type AssignLocationsRequest struct {
+	LocationIDs []int `json:"location_ids"`
+	// DueDate (YYYY-MM-DD) defaults to today plus the loan period.
+	DueDate string `json:"due_date"`
+	// Actor is who made the assignment, for the history.
+	Actor string `json:"actor"`
+}
+
+// AssignLocations checks locations out to a team. Locations the team already
+// has open are left alone. If another team holds any of the locations, or
+// any don't exist or are retired, nothing is assigned and 409 is returned
+// with who holds each of them and why the others are unavailable; use
+// TransferAssignment to move a location between teams.
+func AssignLocations(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team id"})
+			return
+		}
+		var request AssignLocationsRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		if request.DueDate != "" {
+			if _, err := time.Parse("2006-01-02", request.DueDate); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid due_date, expected YYYY-MM-DD"})
+				return
+			}
+		}
+
+		tx, err := db.Beginx()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+			return
+		}
+		defer tx.Rollback()
+
+		if !teamExists(c, tx, c.Param("id")) {
+			return
+		}
+		holders, err := openHolders(tx, request.LocationIDs, teamID)
+		if err != nil {
+			log.Printf("Error checking assignments for team %d: %v", teamID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign locations"})
+			return
+		}
+		unavailable, err := unavailableLocations(tx, request.LocationIDs, teamID)
+		if err != nil {
+			log.Printf("Error checking locations for team %d: %v", teamID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign locations"})
+			return
+		}
+		if len(holders) > 0 || len(unavailable) > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":       "Some locations can't be checked out to this team",
+				"conflicts":   holders,
+				"unavailable": unavailable,
+			})
+			return
+		}
+
+		assigned := 0
+		for _, locationID := range request.LocationIDs {
+			created, err := checkOutLocation(tx, teamID, locationID, request.DueDate, assignmentChange{Actor: request.Actor})
+			if err != nil {
+				log.Printf("Error assigning location %d to team %d: %v", locationID, teamID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign locations"})
+				return
+			}
+			if created {
+				assigned++
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Locations assigned successfully", "assigned": assigned})
+	}
+}
+
+type UpdateAssignmentRequest struct {
+	Status string `json:"status"`
+	// IsCompleted is the older way to set the status: true completes the
+	// assignment and false checks it out again.
+	IsCompleted *bool `json:"is_completed"`
+	// DueDate (YYYY-MM-DD) moves the due date of an open assignment, or sets
+	// it when checking out again.
+	DueDate string `json:"due_date"`
+	Note    string `json:"note"`
+	// Actor is who made the change, for the history.
+	Actor string `json:"actor"`
+}
+
+// UpdateAssignment changes the status or due date of one of a team's
+// assignments. Status changes must follow the lifecycle, or 409 is returned.
+// An assignment is only reassigned by TransferAssignment, which checks the
+// location out to its new team.
+func UpdateAssignment(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID, assignmentID := c.Param("id"), c.Param("assignmentId")
+		var request UpdateAssignmentRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		if request.Status == "" && request.IsCompleted != nil {
+			request.Status = AssignmentCheckedOut
+			if *request.IsCompleted {
+				request.Status = AssignmentCompleted
+			}
+		}
+		if request.Status == AssignmentReassigned {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Reassign a location through /api/assignments/:id/transfer, which needs the team taking it over"})
+			return
+		}
+		if _, ok := assignmentTransitions[request.Status]; request.Status != "" && !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be checked_out, in_progress, returned or completed"})
+			return
+		}
+		if request.DueDate != "" {
+			if _, err := time.Parse("2006-01-02", request.DueDate); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid due_date, expected YYYY-MM-DD"})
+				return
+			}
+		}
+		if request.Status == "" && request.DueDate == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+			return
+		}
+
+		tx, err := db.Beginx()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+			return
+		}
+		defer tx.Rollback()
+
+		var a assignmentRow
+		err = tx.Get(&a, `
+            SELECT id, team_id, location_id, status FROM team_assignments
+            WHERE id = ? AND team_id = ?`, assignmentID, teamID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignment"})
+			return
+		}
+
+		switch {
+		case request.Status != "" && request.Status != a.Status:
+			if !canTransition(a.Status, request.Status) {
+				c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("An assignment can't go from %s to %s", a.Status, request.Status)})
+				return
+			}
+			if request.Status == AssignmentCheckedOut {
+				holders, err := openHolders(tx, []int{a.LocationID}, a.TeamID)
+				if err != nil {
+					log.Printf("Error checking assignment %s: %v", assignmentID, err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assignment"})
+					return
+				}
+				if len(holders) > 0 {
+					c.JSON(http.StatusConflict, gin.H{"error": "The location is checked out to another team", "conflicts": holders})
+					return
+				}
+			}
+			err = transitionAssignment(tx, a, request.Status, request.DueDate, assignmentChange{request.Note, request.Actor})
+			if err == nil && request.DueDate != "" && request.Status != AssignmentCheckedOut {
+				_, err = tx.Exec("UPDATE team_assignments SET due_date = ? WHERE id = ?", request.DueDate, a.ID)
+			}
+		case request.DueDate != "":
+			if !canTransition(a.Status, AssignmentCompleted) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Only an open assignment has a due date"})
+				return
+			}
+			_, err = tx.Exec("UPDATE team_assignments SET due_date = ? WHERE id = ?", request.DueDate, a.ID)
+		}
+		if err != nil {
+			log.Printf("Error updating assignment %s: %v", assignmentID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assignment"})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Assignment updated successfully"})
+	}
+}
+
+type TransferRequest struct {
+	TeamID int `json:"team_id" binding:"required"`
+	// DueDate (YYYY-MM-DD) of the new assignment defaults to today plus the
+	// loan period.
+	DueDate string `json:"due_date"`
+	Note    string `json:"note"`
+	// Actor is who made the change, for the history.
+	Actor string `json:"actor"`
+}
+
+// TransferAssignment hands an open assignment to another team: the current
+// one is closed as reassigned and the location is checked out to the new
+// team.
+func TransferAssignment(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		assignmentID := c.Param("id")
+		var request TransferRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		if request.DueDate != "" {
+			if _, err := time.Parse("2006-01-02", request.DueDate); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid due_date, expected YYYY-MM-DD"})
+				return
+			}
+		}
+
+		tx, err := db.Beginx()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+			return
+		}
+		defer tx.Rollback()
+
+		var a assignmentRow
+		err = tx.Get(&a, "SELECT id, team_id, location_id, status FROM team_assignments WHERE id = ?", assignmentID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignment"})
+			return
+		}
+		if !canTransition(a.Status, AssignmentReassigned) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Only an open assignment can be transferred; this one is %s", a.Status)})
+			return
+		}
+		if request.TeamID == a.TeamID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The location is already checked out to that team"})
+			return
+		}
+		if !teamExists(c, tx, strconv.Itoa(request.TeamID)) {
+			return
+		}
+
+		change := func(prefix string, team int) assignmentChange {
+			note := fmt.Sprintf("%s team %d", prefix, team)
+			if request.Note != "" {
+				note += ": " + request.Note
+			}
+			return assignmentChange{note, request.Actor}
+		}
+		err = transitionAssignment(tx, a, AssignmentReassigned, "", change("transferred to", request.TeamID))
+		if err == nil {
+			_, err = checkOutLocation(tx, request.TeamID, a.LocationID, request.DueDate, change("transferred from", a.TeamID))
+		}
+		var newID int
+		if err == nil {
+			err = tx.Get(&newID, "SELECT id FROM team_assignments WHERE team_id = ? AND location_id = ?", request.TeamID, a.LocationID)
+		}
+		if err != nil {
+			log.Printf("Error transferring assignment %s: %v", assignmentID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer assignment"})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		log.Printf("Transferred location %d from team %d to team %d", a.LocationID, a.TeamID, request.TeamID)
+		c.JSON(http.StatusOK, gin.H{"message": "Assignment transferred successfully", "assignment_id": newID})
+	}
+}
+
+// OverdueAssignment is an open assignment past its due date.
+type OverdueAssignment struct {
+	AssignmentID int       `json:"assignment_id" db:"assignment_id"`
+	TeamID       int       `json:"team_id" db:"team_id"`
+	TeamName     string    `json:"team_name" db:"team_name"`
+	LocationID   int       `json:"location_id" db:"location_id"`
+	LocationName string    `json:"location_name" db:"location_name"`
+	Status       string    `json:"status" db:"status"`
+	AssignedDate time.Time `json:"assigned_date" db:"assigned_date"`
+	DueDate      string    `json:"due_date" db:"due_date"`
+	DaysOverdue  int       `json:"days_overdue" db:"days_overdue"`
+}
+
+// GetOverdueAssignments lists the open assignments past their due date, most
+// overdue first.
+func GetOverdueAssignments(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Due dates are local, so they are compared with the local date
+		// rather than SQLite's DATE('now'), which is UTC.
+		today := campaignDate()
+		overdue := []OverdueAssignment{}
+		err := db.Select(&overdue, `
+            SELECT
+                ta.id as assignment_id,
+                ta.team_id,
+                t.name as team_name,
+                ta.location_id,
+                l.name as location_name,
+                ta.status,
+                ta.assigned_date,
+                DATE(ta.due_date) as due_date,
+                CAST(JULIANDAY(?) - JULIANDAY(DATE(ta.due_date)) AS INTEGER) as days_overdue
+            FROM team_assignments ta
+            JOIN teams t ON t.id = ta.team_id
+            JOIN locations l ON l.id = ta.location_id
+            WHERE `+openAssignment+` AND DATE(ta.due_date) < ?
+            ORDER BY ta.due_date, t.name, l.name`, today, today)
+		if err != nil {
+			log.Printf("Error fetching overdue assignments: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch overdue assignments"})
+			return
+		}
+
+		c.JSON(http.StatusOK, overdue)
+	}
+}
+
+// AssignmentEvent is one status change of an assignment, with the team and
+// location names as they were when it happened.
+type AssignmentEvent struct {
+	ID           int       `json:"id" db:"id"`
+	AssignmentID int       `json:"assignment_id" db:"assignment_id"`
+	TeamID       int       `json:"team_id" db:"team_id"`
+	TeamName     string    `json:"team_name" db:"team_name"`
+	LocationID   int       `json:"location_id" db:"location_id"`
+	LocationName string    `json:"location_name" db:"location_name"`
+	Action       string    `json:"action" db:"action"`
+	FromStatus   *string   `json:"from_status" db:"from_status"`
+	ToStatus     string    `json:"to_status" db:"to_status"`
+	Note         string    `json:"note" db:"note"`
+	Actor        string    `json:"actor" db:"actor"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+const assignmentEventColumns = `id, assignment_id, team_id, team_name, location_id, location_name,
+                   action, from_status, to_status, note, actor, created_at`
+
+// GetAssignmentEvents returns the audit trail of an assignment, oldest first.
+func GetAssignmentEvents(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		events := []AssignmentEvent{}
+		err := db.Select(&events, `
+            SELECT `+assignmentEventColumns+`
+            FROM assignment_events WHERE assignment_id = ?
+            ORDER BY id`, id)
+		if err != nil {
+			log.Printf("Error fetching events of assignment %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignment history"})
+			return
+		}
+		if len(events) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, events)
+	}
+}
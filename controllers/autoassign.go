@@ -0,0 +1,335 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"team-tracker-backend/geo"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Ways of balancing an automatic distribution.
+const (
+	BalanceByCount = "count"
+	BalanceByArea  = "area"
+)
+
+// unassignedLocations selects the active, unpreached locations that have no
+// open assignment, which are the ones auto-assign distributes.
+const unassignedLocations = `COALESCE(is_preached, FALSE) = FALSE
+    AND id NOT IN (SELECT location_id FROM team_assignments ta WHERE ` + openAssignment + `)`
+
+type AutoAssignRequest struct {
+	// TeamIDs are the teams to distribute to; all teams when empty.
+	TeamIDs   []int  `json:"team_ids"`
+	BalanceBy string `json:"balance_by"`
+	// RegionID limits the distribution to a region and its subregions.
+	RegionID *int `json:"region_id"`
+}
+
+// ProposedAssignment is one team's share of an automatic distribution.
+type ProposedAssignment struct {
+	TeamID        int          `json:"team_id"`
+	TeamName      string       `json:"team_name,omitempty"`
+	LocationIDs   []int        `json:"location_ids"`
+	LocationCount int          `json:"location_count"`
+	AreaM2        float64      `json:"area_m2"`
+	Center        geo.Position `json:"center"`
+	// SpreadM is the distance from the centre to the farthest location.
+	SpreadM float64 `json:"spread_m"`
+}
+
+type AutoAssignProposal struct {
+	BalanceBy   string               `json:"balance_by"`
+	Assignments []ProposedAssignment `json:"assignments"`
+}
+
+// PreviewAutoAssign proposes a distribution of the unassigned, unpreached
+// locations among teams: the locations are split into one compact cluster
+// per team, balanced by location count or by area, and each cluster goes to
+// the team whose current assignments are closest to it. Nothing is written;
+// the proposal, edited or not, is applied with CommitAutoAssign.
+func PreviewAutoAssign(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request AutoAssignRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		if request.BalanceBy == "" {
+			request.BalanceBy = BalanceByCount
+		}
+		if request.BalanceBy != BalanceByCount && request.BalanceBy != BalanceByArea {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "balance_by must be count or area"})
+			return
+		}
+
+		teams, err := selectAutoAssignTeams(db, request.TeamIDs)
+		if err != nil {
+			log.Printf("Error fetching teams for auto-assign: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch teams"})
+			return
+		}
+		if len(teams) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No teams to assign to"})
+			return
+		}
+		if len(request.TeamIDs) > 0 && len(teams) != len(request.TeamIDs) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+			return
+		}
+
+		where, args := unassignedLocations, []interface{}{}
+		if request.RegionID != nil {
+			where += " AND region_id IN (" + fmt.Sprintf(regionSubtree, "id = ?") + ")"
+			args = append(args, *request.RegionID)
+		}
+		locations, err := selectLocationShapes(db, where, args...)
+		if err != nil {
+			log.Printf("Error fetching locations for auto-assign: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+			return
+		}
+
+		c.JSON(http.StatusOK, proposeAssignments(teams, locations, request.BalanceBy))
+	}
+}
+
+// autoAssignTeam is a team with the centre of its open assignments, if any.
+type autoAssignTeam struct {
+	ID        int      `db:"id"`
+	Name      string   `db:"name"`
+	Latitude  *float64 `db:"latitude"`
+	Longitude *float64 `db:"longitude"`
+}
+
+func selectAutoAssignTeams(db *sqlx.DB, teamIDs []int) ([]autoAssignTeam, error) {
+	query := `
+        SELECT t.id, t.name, AVG(l.latitude) as latitude, AVG(l.longitude) as longitude
+        FROM teams t
+        LEFT JOIN team_assignments ta ON ta.team_id = t.id AND ` + openAssignment + `
+        LEFT JOIN locations l ON l.id = ta.location_id`
+	var args []interface{}
+	if len(teamIDs) > 0 {
+		var err error
+		query, args, err = sqlx.In(query+" WHERE t.id IN (?)", teamIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	query += " GROUP BY t.id ORDER BY t.id"
+
+	var teams []autoAssignTeam
+	err := db.Select(&teams, query, args...)
+	return teams, err
+}
+
+func proposeAssignments(teams []autoAssignTeam, locations []locationShape, balanceBy string) AutoAssignProposal {
+	proposal := AutoAssignProposal{BalanceBy: balanceBy, Assignments: []ProposedAssignment{}}
+	if len(locations) == 0 {
+		for _, team := range teams {
+			proposal.Assignments = append(proposal.Assignments, ProposedAssignment{TeamID: team.ID, TeamName: team.Name, LocationIDs: []int{}})
+		}
+		return proposal
+	}
+
+	points := make([]geo.Position, len(locations))
+	areas := make([]float64, len(locations))
+	var polygonArea float64
+	var polygons int
+	for i, loc := range locations {
+		points[i] = geo.Position{loc.Longitude, loc.Latitude}
+		areas[i] = loc.Geometry.Area()
+		if areas[i] > 0 {
+			polygonArea += areas[i]
+			polygons++
+		}
+	}
+
+	weights := make([]float64, len(locations))
+	for i := range weights {
+		weights[i] = 1
+		if balanceBy == BalanceByArea {
+			// Points have no area; count them as an average territory so
+			// they still take up room in a team's share.
+			weights[i] = areas[i]
+			if weights[i] == 0 {
+				weights[i] = 1
+				if polygons > 0 {
+					weights[i] = polygonArea / float64(polygons)
+				}
+			}
+		}
+	}
+
+	groups := geo.BalancedClusters(points, weights, len(teams))
+	clusters := make([]ProposedAssignment, len(teams))
+	members := make([][]geo.Position, len(teams))
+	for i, g := range groups {
+		clusters[g].LocationIDs = append(clusters[g].LocationIDs, locations[i].ID)
+		clusters[g].AreaM2 += areas[i]
+		members[g] = append(members[g], points[i])
+	}
+	for g := range clusters {
+		clusters[g].LocationCount = len(clusters[g].LocationIDs)
+		if clusters[g].LocationIDs == nil {
+			clusters[g].LocationIDs = []int{}
+		}
+		if len(members[g]) > 0 {
+			var sum geo.Position
+			for _, p := range members[g] {
+				sum[0] += p[0]
+				sum[1] += p[1]
+			}
+			clusters[g].Center = geo.Position{sum[0] / float64(len(members[g])), sum[1] / float64(len(members[g]))}
+		}
+		for _, p := range members[g] {
+			clusters[g].SpreadM = math.Max(clusters[g].SpreadM, geo.Distance(clusters[g].Center, p))
+		}
+	}
+
+	for i, g := range matchTeamsToClusters(teams, clusters) {
+		cluster := clusters[g]
+		cluster.TeamID = teams[i].ID
+		cluster.TeamName = teams[i].Name
+		proposal.Assignments = append(proposal.Assignments, cluster)
+	}
+	return proposal
+}
+
+// matchTeamsToClusters returns the cluster for each team. Teams that already
+// have open assignments take the cluster nearest them, closest pairs first;
+// the rest take the remaining clusters in order.
+func matchTeamsToClusters(teams []autoAssignTeam, clusters []ProposedAssignment) []int {
+	type pair struct {
+		team, cluster int
+		distance      float64
+	}
+	var pairs []pair
+	for t, team := range teams {
+		if team.Latitude == nil || team.Longitude == nil {
+			continue
+		}
+		home := geo.Position{*team.Longitude, *team.Latitude}
+		for c := range clusters {
+			pairs = append(pairs, pair{t, c, geo.Distance(home, clusters[c].Center)})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].distance < pairs[j].distance })
+
+	match := make([]int, len(teams))
+	for i := range match {
+		match[i] = -1
+	}
+	taken := make([]bool, len(clusters))
+	for _, p := range pairs {
+		if match[p.team] < 0 && !taken[p.cluster] {
+			match[p.team] = p.cluster
+			taken[p.cluster] = true
+		}
+	}
+
+	next := 0
+	for t := range match {
+		if match[t] >= 0 {
+			continue
+		}
+		for taken[next] {
+			next++
+		}
+		match[t] = next
+		taken[next] = true
+	}
+	return match
+}
+
+// AssignmentConflict is a location in an assignment request that can't be
+// assigned to the team.
+type AssignmentConflict struct {
+	LocationID int    `json:"location_id"`
+	TeamID     int    `json:"team_id"`
+	Reason     string `json:"reason"`
+}
+
+// CommitAutoAssign writes a proposal from PreviewAutoAssign into
+// team_assignments in one transaction. If any location has been assigned,
+// preached or retired since the preview, or appears twice, nothing is
+// written and the conflicts are returned.
+func CommitAutoAssign(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Assignments []ProposedAssignment `json:"assignments"`
+			// Actor is who committed the distribution, for the history.
+			Actor string `json:"actor"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil || len(request.Assignments) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		tx, err := db.Beginx()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+			return
+		}
+		defer tx.Rollback()
+
+		var available []int
+		if err := tx.Select(&available, "SELECT id FROM locations WHERE is_retired = FALSE AND "+unassignedLocations); err != nil {
+			log.Printf("Error checking auto-assign locations: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check locations"})
+			return
+		}
+		open := make(map[int]bool, len(available))
+		for _, id := range available {
+			open[id] = true
+		}
+
+		conflicts := []AssignmentConflict{}
+		seen := make(map[int]int)
+		for _, a := range request.Assignments {
+			var exists int
+			if err := tx.Get(&exists, "SELECT COUNT(*) FROM teams WHERE id = ?", a.TeamID); err != nil || exists == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Team %d not found", a.TeamID)})
+				return
+			}
+			for _, id := range a.LocationIDs {
+				switch team, dup := seen[id]; {
+				case dup:
+					conflicts = append(conflicts, AssignmentConflict{id, a.TeamID, fmt.Sprintf("also proposed for team %d", team)})
+				case !open[id]:
+					conflicts = append(conflicts, AssignmentConflict{id, a.TeamID, "location is no longer unassigned and unpreached"})
+				}
+				seen[id] = a.TeamID
+			}
+		}
+		if len(conflicts) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Some locations can no longer be assigned", "conflicts": conflicts})
+			return
+		}
+
+		assigned := 0
+		for _, a := range request.Assignments {
+			for _, id := range a.LocationIDs {
+				if _, err := checkOutLocation(tx, a.TeamID, id, "", assignmentChange{"auto-assigned", request.Actor}); err != nil {
+					log.Printf("Error committing auto-assign: %v", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign locations"})
+					return
+				}
+				assigned++
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		log.Printf("Auto-assigned %d locations to %d teams", assigned, len(request.Assignments))
+		c.JSON(http.StatusOK, gin.H{"message": "Locations assigned successfully", "assigned": assigned})
+	}
+}
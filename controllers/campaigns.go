@@ -0,0 +1,350 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Campaign is a coverage cycle. Locations are preached afresh in each one.
+type Campaign struct {
+	ID        int     `json:"id" db:"id"`
+	Name      string  `json:"name" db:"name"`
+	StartDate string  `json:"start_date" db:"start_date"`
+	EndDate   *string `json:"end_date" db:"end_date"`
+	IsCurrent bool    `json:"is_current" db:"is_current"`
+}
+
+// currentCampaignID selects the id of the latest campaign to have started
+// by the date bound to it, which is campaignDate().
+const currentCampaignID = `SELECT id FROM campaigns WHERE start_date <= ?
+                         ORDER BY start_date DESC LIMIT 1`
+
+// campaignColumns binds campaignDate() for is_current.
+const campaignColumns = `id, name, DATE(start_date) as start_date, DATE(end_date) as end_date,
+                   id = (` + currentCampaignID + `) as is_current`
+
+// preachedInCampaign is the condition for location l, or one it was split
+// or merged from, having a preached visit within campaign c. Visits are
+// dated in local time, like campaigns.
+const preachedInCampaign = `EXISTS (
+                SELECT 1 FROM location_visits v
+                WHERE v.location_id IN (` + LineageLocationIDs + `) AND v.is_preached = TRUE
+                  AND DATE(v.visit_date, 'localtime') >= c.start_date
+                  AND (c.end_date IS NULL OR DATE(v.visit_date, 'localtime') <= c.end_date))`
+
+// campaignDate is today's date in local time. Campaigns start and end on
+// local dates, so it is bound into every query rather than taking SQLite's
+// DATE('now'), which is UTC.
+func campaignDate() string {
+	return time.Now().Format("2006-01-02")
+}
+
+// CampaignProgress is how far a campaign has got: active locations preached
+// within it, by count and by area, and the visits made during it with their
+// outcomes.
+type CampaignProgress struct {
+	Campaign
+	TotalLocations    int     `json:"total_locations" db:"total_locations"`
+	PreachedLocations int     `json:"preached_locations" db:"preached_locations"`
+	LocationCoverage  float64 `json:"location_coverage" db:"-"`
+	TotalAreaM2       float64 `json:"total_area_m2" db:"total_area_m2"`
+	PreachedAreaM2    float64 `json:"preached_area_m2" db:"preached_area_m2"`
+	AreaCoverage      float64 `json:"area_coverage" db:"-"`
+	Visits            int     `json:"visits" db:"visits"`
+	Teams             int     `json:"teams" db:"teams"`
+	// DaysRemaining is left out for a campaign with no end date.
+	DaysRemaining *int           `json:"days_remaining,omitempty" db:"-"`
+	Outcomes      []OutcomeTotal `json:"outcomes" db:"-"`
+}
+
+// campaignProgress measures a campaign against the locations active now.
+func campaignProgress(q sqlx.Queryer, campaign Campaign) (CampaignProgress, error) {
+	progress := CampaignProgress{Campaign: campaign}
+	err := sqlx.Get(q, &progress, `
+        WITH c AS (SELECT start_date, end_date FROM campaigns WHERE id = ?)
+        SELECT
+            COUNT(*) as total_locations,
+            COALESCE(SUM(preached), 0) as preached_locations,
+            COALESCE(SUM(area_m2), 0) as total_area_m2,
+            COALESCE(SUM(CASE WHEN preached THEN area_m2 END), 0) as preached_area_m2,
+            (SELECT COUNT(*) FROM location_visits v, c
+             WHERE DATE(v.visit_date, 'localtime') >= c.start_date
+               AND (c.end_date IS NULL OR DATE(v.visit_date, 'localtime') <= c.end_date)) as visits,
+            (SELECT COUNT(DISTINCT v.team_id) FROM location_visits v, c
+             WHERE DATE(v.visit_date, 'localtime') >= c.start_date
+               AND (c.end_date IS NULL OR DATE(v.visit_date, 'localtime') <= c.end_date)) as teams
+        FROM (
+            SELECT COALESCE(l.area_m2, 0) as area_m2, `+preachedInCampaign+` as preached
+            FROM locations l, c
+            WHERE l.is_retired = FALSE
+        )`, campaign.ID)
+	if err != nil {
+		return progress, fmt.Errorf("failed to measure campaign %d: %v", campaign.ID, err)
+	}
+	if progress.TotalLocations > 0 {
+		progress.LocationCoverage = float64(progress.PreachedLocations) / float64(progress.TotalLocations)
+	}
+	if progress.TotalAreaM2 > 0 {
+		progress.AreaCoverage = progress.PreachedAreaM2 / progress.TotalAreaM2
+	}
+	end := ""
+	if campaign.EndDate != nil {
+		end = *campaign.EndDate
+	}
+	if progress.Outcomes, err = outcomeTotals(q, campaign.StartDate, end); err != nil {
+		return progress, err
+	}
+	if campaign.EndDate != nil {
+		if end, err := time.Parse("2006-01-02", *campaign.EndDate); err == nil {
+			today, _ := time.Parse("2006-01-02", campaignDate())
+			days := max(int(end.Sub(today).Hours()/24), 0)
+			progress.DaysRemaining = &days
+		}
+	}
+	return progress, nil
+}
+
+// CurrentCampaign returns the latest campaign to have started, and its
+// progress. It returns sql.ErrNoRows when no campaign has started yet.
+func CurrentCampaign(q sqlx.Queryer) (CampaignProgress, error) {
+	var campaign Campaign
+	err := sqlx.Get(q, &campaign, `
+        SELECT `+campaignColumns+` FROM campaigns WHERE id = (`+currentCampaignID+`)`,
+		campaignDate(), campaignDate())
+	if err == sql.ErrNoRows {
+		return CampaignProgress{}, err
+	}
+	if err != nil {
+		return CampaignProgress{}, fmt.Errorf("failed to fetch current campaign: %v", err)
+	}
+	return campaignProgress(q, campaign)
+}
+
+// openCampaign starts a campaign on start, which the caller has checked is
+// after the current one started and no later than today. The current
+// campaign ends the day before, and locations.is_preached is recomputed
+// for the new one.
+func openCampaign(tx *sqlx.Tx, name, start string, end *string) (int, error) {
+	_, err := tx.Exec(`
+        UPDATE campaigns SET end_date = DATE(?, '-1 day')
+        WHERE start_date < ? AND (end_date IS NULL OR end_date >= ?)`, start, start, start)
+	if err != nil {
+		return 0, fmt.Errorf("failed to close the current campaign: %v", err)
+	}
+	result, err := tx.Exec("INSERT INTO campaigns (name, start_date, end_date) VALUES (?, ?, ?)", name, start, end)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create campaign: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	return int(id), refreshPreached(tx, int(id))
+}
+
+// refreshPreached recomputes locations.is_preached for a campaign.
+func refreshPreached(tx *sqlx.Tx, campaignID int) error {
+	_, err := tx.Exec(`
+        UPDATE locations AS l SET is_preached = (
+            SELECT `+preachedInCampaign+` FROM campaigns c WHERE c.id = ?)`, campaignID)
+	if err != nil {
+		return fmt.Errorf("failed to recompute preached status: %v", err)
+	}
+	return nil
+}
+
+// refreshLocationPreached recomputes is_preached for one location from the
+// visits of its lineage: those in the current campaign, or any at all before
+// the first campaign has started.
+func refreshLocationPreached(tx *sqlx.Tx, id int) error {
+	_, err := tx.Exec(`
+        UPDATE locations AS l SET is_preached = COALESCE(
+            (SELECT `+preachedInCampaign+` FROM campaigns c WHERE c.id = (`+currentCampaignID+`)),
+            EXISTS (SELECT 1 FROM location_visits v
+                    WHERE v.location_id IN (`+LineageLocationIDs+`) AND v.is_preached = TRUE))
+        WHERE l.id = ?`, campaignDate(), id)
+	if err != nil {
+		return fmt.Errorf("failed to recompute preached status of location %d: %v", id, err)
+	}
+	return nil
+}
+
+// RollCoverageCycle opens the next campaign when the current one has passed
+// its end date. The next one starts the day after and lasts as long, so a
+// campaign with an end date repeats on that schedule until changed.
+func RollCoverageCycle(db *sqlx.DB) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	today := campaignDate()
+	for {
+		var current Campaign
+		err := tx.Get(&current, `
+            SELECT `+campaignColumns+` FROM campaigns WHERE id = (`+currentCampaignID+`)`, today, today)
+		if err == sql.ErrNoRows {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch current campaign: %v", err)
+		}
+		if current.EndDate == nil || *current.EndDate >= today {
+			break
+		}
+
+		start, err1 := time.Parse("2006-01-02", current.StartDate)
+		end, err2 := time.Parse("2006-01-02", *current.EndDate)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("campaign %d has invalid dates", current.ID)
+		}
+		next := end.AddDate(0, 0, 1)
+		nextEnd := next.Add(end.Sub(start)).Format("2006-01-02")
+
+		var count int
+		if err := tx.Get(&count, "SELECT COUNT(*) FROM campaigns"); err != nil {
+			return err
+		}
+		name := fmt.Sprintf("Cycle %d", count+1)
+		if _, err := openCampaign(tx, name, next.Format("2006-01-02"), &nextEnd); err != nil {
+			return err
+		}
+		log.Printf("Campaign %q ended on %s; opened %q until %s", current.Name, *current.EndDate, name, nextEnd)
+	}
+	return tx.Commit()
+}
+
+// GetCampaigns lists every campaign, newest first, with its progress.
+func GetCampaigns(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var campaigns []Campaign
+		if err := db.Select(&campaigns, "SELECT "+campaignColumns+" FROM campaigns ORDER BY start_date DESC", campaignDate()); err != nil {
+			log.Printf("Error fetching campaigns: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch campaigns"})
+			return
+		}
+
+		progress := make([]CampaignProgress, 0, len(campaigns))
+		for _, campaign := range campaigns {
+			p, err := campaignProgress(db, campaign)
+			if err != nil {
+				log.Printf("Error measuring campaigns: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch campaigns"})
+				return
+			}
+			progress = append(progress, p)
+		}
+
+		c.JSON(http.StatusOK, progress)
+	}
+}
+
+// GetCurrentCampaign returns the current campaign with its progress.
+func GetCurrentCampaign(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		progress, err := CurrentCampaign(db)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No campaign has started yet"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching current campaign: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch current campaign"})
+			return
+		}
+
+		c.JSON(http.StatusOK, progress)
+	}
+}
+
+type CampaignRequest struct {
+	Name string `json:"name"`
+	// StartDate (YYYY-MM-DD) defaults to today. It can be backdated, but not
+	// to or before the start of the current campaign.
+	StartDate string `json:"start_date"`
+	// EndDate (YYYY-MM-DD) is optional. When it passes, a campaign of the
+	// same length is opened automatically.
+	EndDate *string `json:"end_date"`
+}
+
+// OpenCampaign starts a new coverage cycle. The current one ends the day
+// before it starts, and every location is unpreached again until a visit
+// within the new cycle preaches it.
+func OpenCampaign(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request CampaignRequest
+		if err := c.ShouldBindJSON(&request); err != nil || strings.TrimSpace(request.Name) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		today := campaignDate()
+		if request.StartDate == "" {
+			request.StartDate = today
+		}
+		if _, err := time.Parse("2006-01-02", request.StartDate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date, expected YYYY-MM-DD"})
+			return
+		}
+		if request.StartDate > today {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start_date can't be in the future"})
+			return
+		}
+		if request.EndDate != nil {
+			if _, err := time.Parse("2006-01-02", *request.EndDate); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date, expected YYYY-MM-DD"})
+				return
+			}
+			if *request.EndDate < today {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must be today or later"})
+				return
+			}
+		}
+
+		tx, err := db.Beginx()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+			return
+		}
+		defer tx.Rollback()
+
+		// With no campaign started yet, any start up to today will do.
+		current, err := CurrentCampaign(tx)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Error opening campaign: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open campaign"})
+			return
+		}
+		if err == nil && request.StartDate <= current.StartDate {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf(
+				"The current campaign %q started on %s; a new one must start after that", current.Name, current.StartDate)})
+			return
+		}
+
+		id, err := openCampaign(tx, request.Name, request.StartDate, request.EndDate)
+		if err != nil {
+			log.Printf("Error opening campaign: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open campaign"})
+			return
+		}
+		progress, err := CurrentCampaign(tx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch campaign"})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		log.Printf("Opened campaign %d %q from %s", id, request.Name, request.StartDate)
+		if current.ID != 0 {
+			log.Printf("Closed campaign %d %q", current.ID, current.Name)
+		}
+		c.JSON(http.StatusCreated, progress)
+	}
+}
@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"team-tracker-backend/geo"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Kinds of territory conflict.
+const (
+	ConflictOverlap        = "overlap"
+	ConflictPointInPolygon = "point_in_polygon"
+	ConflictDuplicate      = "duplicate"
+)
+
+const (
+	defaultDuplicateDistance = 25   // metres between two locations' centres
+	maxDuplicateDistance     = 1000 // metres
+	// sameNameDistance is how far apart two locations with similar names can
+	// be and still be taken for the same place; stores in a chain share a
+	// name across town.
+	sameNameDistance = 1000 // metres
+)
+
+// ConflictLocation identifies one side of a conflict.
+type ConflictLocation struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// LocationConflict is a pair of active locations that probably describe the
+// same ground twice.
+type LocationConflict struct {
+	Kind      string              `json:"kind"`
+	Locations [2]ConflictLocation `json:"locations"`
+	// DistanceM is the distance between the two locations' centres.
+	DistanceM float64 `json:"distance_m"`
+	// OverlapM2 is the estimated overlapping area of two polygons.
+	OverlapM2 float64 `json:"overlap_m2,omitempty"`
+	Reason    string  `json:"reason"`
+}
+
+// findConflicts compares every pair of locations. A pair is reported once,
+// under the first kind that applies: similar names close together, then
+// overlapping polygons, then a point inside a polygon, then centres within
+// duplicateDistance metres of each other.
+func findConflicts(locations []locationShape, duplicateDistance float64) []LocationConflict {
+	type prepared struct {
+		names    string
+		center   geo.Position
+		polygons bool
+		bounds   [4]float64
+	}
+	shapes := make([]prepared, len(locations))
+	for i, loc := range locations {
+		minLon, minLat, maxLon, maxLat, _ := loc.Geometry.Bounds()
+		shapes[i] = prepared{
+			names:    normalizeName(loc.Name),
+			center:   geo.Position{loc.Longitude, loc.Latitude},
+			polygons: len(loc.Geometry.Polygons()) > 0,
+			bounds:   [4]float64{minLon, minLat, maxLon, maxLat},
+		}
+	}
+
+	// Anything further apart than this can't conflict, which saves measuring
+	// most pairs.
+	metresPerDegree := geo.Distance(geo.Position{0, 0}, geo.Position{0, 1})
+	farthest := math.Max(duplicateDistance, sameNameDistance)
+
+	conflicts := []LocationConflict{}
+	for i := range locations {
+		for j := i + 1; j < len(locations); j++ {
+			a, b := shapes[i], shapes[j]
+			boxesMeet := a.bounds[0] <= b.bounds[2] && b.bounds[0] <= a.bounds[2] &&
+				a.bounds[1] <= b.bounds[3] && b.bounds[1] <= a.bounds[3]
+			if !boxesMeet && math.Abs(a.center.Lat()-b.center.Lat())*metresPerDegree > farthest {
+				continue
+			}
+
+			distance := geo.Distance(a.center, b.center)
+			conflict := LocationConflict{
+				Locations: [2]ConflictLocation{
+					{ID: locations[i].ID, Name: locations[i].Name},
+					{ID: locations[j].ID, Name: locations[j].Name},
+				},
+				DistanceM: distance,
+			}
+
+			switch {
+			case distance <= sameNameDistance && similarNames(a.names, b.names):
+				conflict.Kind = ConflictDuplicate
+				conflict.Reason = fmt.Sprintf("similar names %.0f m apart", distance)
+			case boxesMeet && a.polygons && b.polygons:
+				overlaps, area := geo.Overlap(locations[i].Geometry, locations[j].Geometry)
+				if !overlaps {
+					continue
+				}
+				conflict.Kind = ConflictOverlap
+				conflict.OverlapM2 = area
+				conflict.Reason = fmt.Sprintf("polygons overlap by about %.0f m²", area)
+				if area == 0 {
+					conflict.Reason = "polygon edges cross"
+				}
+			case boxesMeet && a.polygons != b.polygons:
+				polygon, point := locations[i], locations[j]
+				if b.polygons {
+					polygon, point = point, polygon
+				}
+				if !polygon.Geometry.Contains(geo.Position{point.Longitude, point.Latitude}) {
+					continue
+				}
+				conflict.Kind = ConflictPointInPolygon
+				conflict.Reason = fmt.Sprintf("%s lies inside %s", strings.TrimSpace(point.Name), strings.TrimSpace(polygon.Name))
+			case distance <= duplicateDistance:
+				conflict.Kind = ConflictDuplicate
+				conflict.Reason = fmt.Sprintf("centres %.0f m apart", distance)
+			default:
+				continue
+			}
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts
+}
+
+var (
+	parenthetical   = regexp.MustCompile(`\([^)]*\)`)
+	nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// normalizeName reduces a name to lower-case letters and digits, without
+// remarks in brackets such as "(Area)", so "Bass Pro Shop (area)" and "Bass
+// Pro Shop" compare equal.
+func normalizeName(name string) string {
+	name = strings.ToLower(name)
+	name = parenthetical.ReplaceAllString(name, " ")
+	name = strings.ReplaceAll(name, "&", " and ")
+	return nonAlphanumeric.ReplaceAllString(name, "")
+}
+
+// similarNames compares normalized names. Names without digits may differ
+// by a typo or two ("Barnes & Noble", "Barnes and Nobles"); names with
+// digits are usually addresses, where one digit is a different building.
+func similarNames(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	if a == b {
+		return true
+	}
+	if strings.ContainsAny(a+b, "0123456789") {
+		return false
+	}
+	return editDistance(a, b) <= min(len(a), len(b))/8
+}
+
+// editDistance is the Levenshtein distance between two byte strings.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// sourceConflicts finds the conflicts that involve at least one active
+// location from the given sources, for the import report.
+func sourceConflicts(q sqlx.Queryer, sources []string) ([]LocationConflict, error) {
+	shapes, err := selectLocationShapes(q, "TRUE")
+	if err != nil {
+		return nil, err
+	}
+	query, args, err := sqlx.In("SELECT id FROM locations WHERE source IN (?) AND is_retired = FALSE", sources)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	if err := sqlx.Select(q, &ids, query, args...); err != nil {
+		return nil, err
+	}
+	fromSource := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		fromSource[id] = true
+	}
+
+	conflicts := []LocationConflict{}
+	for _, conflict := range findConflicts(shapes, defaultDuplicateDistance) {
+		if fromSource[conflict.Locations[0].ID] || fromSource[conflict.Locations[1].ID] {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts, nil
+}
+
+// GetLocationConflicts lists pairs of active locations that overlap or
+// duplicate each other: polygons that overlap, points that lie inside a
+// polygon, and locations with similar names or centres within distance_m
+// metres (default 25). kind limits the list to one kind of conflict.
+func GetLocationConflicts(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		distance, err := strconv.ParseFloat(c.DefaultQuery("distance_m", strconv.Itoa(defaultDuplicateDistance)), 64)
+		if err != nil || distance < 0 || distance > maxDuplicateDistance {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("distance_m must be between 0 and %d", maxDuplicateDistance)})
+			return
+		}
+		kind := c.Query("kind")
+		if kind != "" && kind != ConflictOverlap && kind != ConflictPointInPolygon && kind != ConflictDuplicate {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be overlap, point_in_polygon or duplicate"})
+			return
+		}
+
+		shapes, err := selectLocationShapes(db, "TRUE")
+		if err != nil {
+			log.Printf("Error fetching locations for conflicts: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+			return
+		}
+
+		conflicts := []LocationConflict{}
+		for _, conflict := range findConflicts(shapes, distance) {
+			if kind == "" || conflict.Kind == kind {
+				conflicts = append(conflicts, conflict)
+			}
+		}
+		sort.SliceStable(conflicts, func(i, j int) bool { return conflicts[i].Kind < conflicts[j].Kind })
+
+		c.JSON(http.StatusOK, conflicts)
+	}
+}
@@ -0,0 +1,575 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"team-tracker-backend/geo"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// csvColumns describes the columns a CSV import understands. Aliases map
+// alternative header names, after normalization, to the column name.
+type csvColumns struct {
+	Required []string
+	Optional []string
+	Aliases  map[string]string
+}
+
+// csvHeader maps column names to their index in a row.
+type csvHeader map[string]int
+
+// readCSVHeader reads and validates the header row. Headers are matched
+// case-insensitively with spaces treated as underscores; a missing required
+// column or a repeated column fails the whole file, while unknown columns
+// are returned so they can be reported and ignored.
+func readCSVHeader(r *csv.Reader, columns csvColumns) (csvHeader, []string, error) {
+	names, err := r.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("CSV file is empty")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CSV header: %v", err)
+	}
+
+	known := make(map[string]bool)
+	for _, name := range append(append([]string{}, columns.Required...), columns.Optional...) {
+		known[name] = true
+	}
+
+	header := make(csvHeader)
+	var ignored []string
+	for i, raw := range names {
+		// Excel writes a byte order mark before the first header.
+		name := strings.TrimPrefix(raw, "\ufeff")
+		name = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+		if alias, ok := columns.Aliases[name]; ok {
+			name = alias
+		}
+		if !known[name] {
+			ignored = append(ignored, strings.TrimSpace(raw))
+			continue
+		}
+		if _, dup := header[name]; dup {
+			return nil, nil, fmt.Errorf("column %q appears more than once", name)
+		}
+		header[name] = i
+	}
+
+	var missing []string
+	for _, name := range columns.Required {
+		if _, ok := header[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("missing required column(s): %s", strings.Join(missing, ", "))
+	}
+	return header, ignored, nil
+}
+
+// get returns the trimmed value of a column, or "" if the file doesn't have it.
+func (h csvHeader) get(row []string, name string) string {
+	if i, ok := h[name]; ok && i < len(row) {
+		return strings.TrimSpace(row[i])
+	}
+	return ""
+}
+
+func newCSVReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	return reader
+}
+
+var locationCSVColumns = csvColumns{
+	Required: []string{"name", "latitude", "longitude"},
+	Optional: []string{"region", "description", "address", "notes", "location_type", "source_key"},
+	Aliases: map[string]string{
+		"lat": "latitude", "lon": "longitude", "lng": "longitude", "long": "longitude",
+		"type": "location_type",
+	},
+}
+
+// ParseLocationsCSV reads a spreadsheet of point locations with name,
+// latitude and longitude columns and an optional region path. Rows that
+// can't be read are reported as issues with their row number; the rest are
+// imported under fallbackSource, which is the file name.
+func ParseLocationsCSV(r io.Reader, fallbackSource string) (*ParsedImport, error) {
+	reader := newCSVReader(r)
+	header, ignored, err := readCSVHeader(reader, locationCSVColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := &ParsedImport{Source: fallbackSource, Format: "csv"}
+	for _, column := range ignored {
+		parsed.Issues = append(parsed.Issues, ImportIssue{
+			Name:   column,
+			Status: IssueUnsupported,
+			Reason: "unknown column ignored",
+		})
+	}
+
+	keys := make(map[string]int)
+	for rowNum := 2; ; rowNum++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV row %d: %v", rowNum, err)
+		}
+
+		name := header.get(row, "name")
+		region := header.get(row, "region")
+		invalid := func(reason string) {
+			label := name
+			if label == "" {
+				label = fmt.Sprintf("row %d", rowNum)
+			}
+			parsed.Issues = append(parsed.Issues, ImportIssue{
+				Name:   label,
+				Region: region,
+				Status: IssueInvalid,
+				Reason: fmt.Sprintf("row %d: %s", rowNum, reason),
+			})
+		}
+
+		if name == "" {
+			invalid("name is empty")
+			continue
+		}
+		lat, err := strconv.ParseFloat(header.get(row, "latitude"), 64)
+		if err != nil {
+			invalid(fmt.Sprintf("invalid latitude %q", header.get(row, "latitude")))
+			continue
+		}
+		lon, err := strconv.ParseFloat(header.get(row, "longitude"), 64)
+		if err != nil {
+			invalid(fmt.Sprintf("invalid longitude %q", header.get(row, "longitude")))
+			continue
+		}
+		point := geo.NewPoint(lon, lat)
+		if err := point.Validate(); err != nil {
+			invalid(err.Error())
+			continue
+		}
+
+		var regionPath []string
+		for _, part := range strings.Split(region, " / ") {
+			if part = strings.TrimSpace(part); part != "" {
+				regionPath = append(regionPath, part)
+			}
+		}
+
+		sourceKey := header.get(row, "source_key")
+		if sourceKey == "" {
+			sourceKey = recordKey(regionPath, "", name, "point", keys)
+		}
+
+		description := header.get(row, "description")
+		details := parseDescription(name, description, nil)
+		if _, ok := header["address"]; ok {
+			details.Address = header.get(row, "address")
+		}
+		if _, ok := header["notes"]; ok {
+			details.Notes = header.get(row, "notes")
+		}
+		if t := header.get(row, "location_type"); t != "" {
+			details.LocationType = t
+		}
+
+		parsed.Records = append(parsed.Records, importedLocation{
+			SourceKey:    sourceKey,
+			RegionPath:   regionPath,
+			Name:         name,
+			Description:  description,
+			Address:      details.Address,
+			Notes:        details.Notes,
+			LocationType: details.LocationType,
+			MediaURLs:    details.MediaURLs,
+			Geometry:     point,
+		})
+	}
+
+	return parsed, nil
+}
+
+// ImportLocationsCSV accepts a multipart upload of a locations spreadsheet
+// in the "file" field and imports it like CreateImport does KML files.
+func ImportLocationsCSV(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		upload, ok := readUpload(c, ".csv")
+		if !ok {
+			return
+		}
+		defer upload.File.Close()
+
+		parsed, err := ParseLocationsCSV(upload.File, upload.Fallback)
+		runImport(c, db, upload.Filename, "csv", upload.DryRun, parsed, err)
+	}
+}
+
+var teamCSVColumns = csvColumns{
+	Required: []string{"name", "leader"},
+	Optional: []string{"members"},
+	Aliases:  map[string]string{"team": "name", "team_name": "name"},
+}
+
+// CSVRowError is a spreadsheet row that could not be imported.
+type CSVRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type TeamImportSummary struct {
+	DryRun         bool          `json:"dry_run"`
+	Added          int           `json:"added"`
+	Updated        int           `json:"updated"`
+	Unchanged      int           `json:"unchanged"`
+	IgnoredColumns []string      `json:"ignored_columns,omitempty"`
+	Errors         []CSVRowError `json:"errors"`
+}
+
+// ImportTeamsCSV accepts a multipart upload of a team roster with name,
+// leader and members columns. Members are separated by semicolons or line
+// breaks within the cell. Teams are matched by name, ignoring case, so a
+// roster can be re-imported after editing, and people by name, so the
+// team memberships are updated rather than duplicated. Rows with errors,
+// such as a leader who already leads another team, are reported and
+// skipped; with dry_run=true nothing is written.
+func ImportTeamsCSV(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		upload, ok := readUpload(c, ".csv")
+		if !ok {
+			return
+		}
+		defer upload.File.Close()
+
+		reader := newCSVReader(upload.File)
+		header, ignored, err := readCSVHeader(reader, teamCSVColumns)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+
+		tx, err := db.Beginx()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+			return
+		}
+		defer tx.Rollback()
+
+		summary := TeamImportSummary{DryRun: upload.DryRun, IgnoredColumns: ignored, Errors: []CSVRowError{}}
+		seen := make(map[string]int)
+		for rowNum := 2; ; rowNum++ {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("failed to read CSV row %d: %v", rowNum, err)})
+				return
+			}
+
+			name, leader := header.get(row, "name"), header.get(row, "leader")
+			switch {
+			case name == "":
+				summary.Errors = append(summary.Errors, CSVRowError{rowNum, "name is empty"})
+				continue
+			case leader == "":
+				summary.Errors = append(summary.Errors, CSVRowError{rowNum, "leader is empty"})
+				continue
+			}
+			if first, dup := seen[strings.ToLower(name)]; dup {
+				summary.Errors = append(summary.Errors, CSVRowError{rowNum, fmt.Sprintf("team %q already appears on row %d", name, first)})
+				continue
+			}
+			seen[strings.ToLower(name)] = rowNum
+
+			members := splitMembers(header.get(row, "members"))
+
+			var existing Team
+			err = tx.Get(&existing, "SELECT t.id, t.name, "+teamRosterColumns+" FROM teams t WHERE t.name = ? COLLATE NOCASE ORDER BY t.id LIMIT 1", name)
+			if err != nil && err != sql.ErrNoRows {
+				log.Printf("Error importing team %q: %v", name, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import teams"})
+				return
+			}
+			if err == nil && strings.EqualFold(existing.Leader, leader) && sameNames(splitMembers(existing.Members), members) {
+				summary.Unchanged++
+				continue
+			}
+
+			// Undo this row alone if its roster breaks a rule.
+			if _, err := tx.Exec("SAVEPOINT team_row"); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import teams"})
+				return
+			}
+			added := err == sql.ErrNoRows
+			if added {
+				var result sql.Result
+				result, err = tx.Exec("INSERT INTO teams (name, leader) VALUES (?, '')", name)
+				if err == nil {
+					id, _ := result.LastInsertId()
+					existing.ID = int(id)
+				}
+			}
+			if err == nil {
+				err = syncRoster(tx, existing.ID, leader, members)
+			}
+
+			var conflict *rosterConflict
+			switch {
+			case errors.As(err, &conflict):
+				summary.Errors = append(summary.Errors, CSVRowError{rowNum, conflict.Error()})
+				_, err = tx.Exec("ROLLBACK TO team_row")
+			case err == nil && added:
+				summary.Added++
+			case err == nil:
+				summary.Updated++
+			}
+			if err == nil {
+				_, err = tx.Exec("RELEASE team_row")
+			}
+			if err != nil {
+				log.Printf("Error importing team %q: %v", name, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import teams"})
+				return
+			}
+		}
+
+		if !upload.DryRun {
+			if err := tx.Commit(); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+				return
+			}
+		}
+
+		log.Printf("Team import of %s complete (dry run: %t): %d added, %d updated, %d unchanged, %d errors",
+			upload.Filename, upload.DryRun, summary.Added, summary.Updated, summary.Unchanged, len(summary.Errors))
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+// syncRoster makes a team's current roster match a spreadsheet row: the
+// leader leads it, listed members who aren't on it join as members, and
+// members no longer listed leave. Members already on the team keep their
+// role.
+func syncRoster(tx *sqlx.Tx, teamID int, leader string, members []string) error {
+	if err := setTeamLeader(tx, teamID, leader); err != nil {
+		return err
+	}
+	leaderID, err := findOrCreateMember(tx, leader)
+	if err != nil {
+		return err
+	}
+
+	listed := []int{leaderID}
+	today := time.Now().Format("2006-01-02")
+	for _, name := range members {
+		memberID, err := findOrCreateMember(tx, name)
+		if err != nil {
+			return err
+		}
+		listed = append(listed, memberID)
+
+		var current int
+		err = tx.Get(&current, `
+            SELECT COUNT(*) FROM team_memberships
+            WHERE team_id = ? AND member_id = ? AND left_at IS NULL`, teamID, memberID)
+		if err != nil {
+			return err
+		}
+		if current == 0 {
+			if err := joinTeam(tx, teamID, memberID, RoleMember, today); err != nil {
+				return err
+			}
+		}
+	}
+
+	query, args, err := sqlx.In(`
+        UPDATE team_memberships SET left_at = ?
+        WHERE team_id = ? AND left_at IS NULL AND member_id NOT IN (?)`, today, teamID, listed)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query, args...)
+	return err
+}
+
+// sameNames reports whether two lists hold the same names in any order,
+// ignoring case.
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := make(map[string]int)
+	for _, name := range a {
+		count[strings.ToLower(name)]++
+	}
+	for _, name := range b {
+		if count[strings.ToLower(name)]--; count[strings.ToLower(name)] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func splitMembers(cell string) []string {
+	var members []string
+	for _, m := range strings.FieldsFunc(cell, func(r rune) bool { return r == ';' || r == '\n' }) {
+		if m = strings.TrimSpace(m); m != "" {
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+// csvFlushRows is how many rows are written between flushes when streaming.
+const csvFlushRows = 500
+
+// streamCSV runs a query and writes its rows as a CSV download without
+// holding the result in memory. Errors before the first byte get a JSON
+// response; later ones can only be logged, leaving the file truncated.
+func streamCSV(c *gin.Context, db *sqlx.DB, filename string, header []string, query string, args ...interface{}) {
+	rows, err := db.Queryx(query, args...)
+	if err != nil {
+		log.Printf("Error exporting %s: %v", filename, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export " + filename})
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write(header)
+
+	record := make([]string, len(header))
+	for n := 1; rows.Next(); n++ {
+		values, err := rows.SliceScan()
+		if err != nil {
+			log.Printf("Error exporting %s: %v", filename, err)
+			break
+		}
+		for i, v := range values {
+			record[i] = csvValue(v)
+		}
+		if err := w.Write(record); err != nil {
+			log.Printf("Error writing %s: %v", filename, err)
+			return
+		}
+		if n%csvFlushRows == 0 {
+			w.Flush()
+			c.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error exporting %s: %v", filename, err)
+	}
+	w.Flush()
+}
+
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// ExportVisitsCSV streams the visit history, newest first, with the same
+// fields as /api/visits/history. Outcomes are written as code=count pairs
+// separated by semicolons.
+func ExportVisitsCSV(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		streamCSV(c, db, "visits.csv",
+			[]string{"id", "visit_date", "team_id", "team_name", "location_id", "location_name", "is_preached", "outcomes", "notes"}, `
+            SELECT
+                v.id,
+                v.visit_date,
+                v.team_id,
+                t.name as team_name,
+                v.location_id,
+                l.name as location_name,
+                CASE WHEN v.is_preached THEN 'true' ELSE 'false' END,
+                COALESCE((SELECT group_concat(code || '=' || count, '; ')
+                          FROM (SELECT vo.code, o.count FROM location_visit_outcomes o
+                                JOIN visit_outcomes vo ON vo.id = o.outcome_id
+                                WHERE o.visit_id = v.id ORDER BY vo.sort_order, vo.id)), ''),
+                COALESCE(v.notes, '')
+            FROM location_visits v
+            JOIN teams t ON v.team_id = t.id
+            JOIN locations l ON v.location_id = l.id
+            ORDER BY v.visit_date DESC`)
+	}
+}
+
+// ExportLocationStatusCSV streams every active location with the status
+// fields of /api/locations/status.
+func ExportLocationStatusCSV(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		streamCSV(c, db, "locations.csv",
+			[]string{"id", "name", "latitude", "longitude", "region_id", "location_type", "address", "is_preached", "visit_count", "last_visit"}, `
+            SELECT
+                l.id,
+                l.name,
+                l.latitude,
+                l.longitude,
+                l.region_id,
+                l.location_type,
+                l.address,
+                CASE WHEN l.is_preached THEN 'true' ELSE 'false' END,
+                COUNT(v.id),
+                COALESCE(MAX(v.visit_date), '')
+            FROM locations l
+            LEFT JOIN location_visits v ON v.location_id IN (`+LineageLocationIDs+`)
+            WHERE l.is_retired = FALSE
+            GROUP BY l.id
+            ORDER BY l.id`)
+	}
+}
+
+// ExportAssignmentsCSV streams every team assignment.
+func ExportAssignmentsCSV(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		streamCSV(c, db, "assignments.csv",
+			[]string{"id", "team_id", "team_name", "location_id", "location_name", "status", "is_completed", "assigned_date", "due_date", "completed_date", "returned_date"}, `
+            SELECT
+                ta.id,
+                ta.team_id,
+                t.name as team_name,
+                ta.location_id,
+                l.name as location_name,
+                ta.status,
+                CASE WHEN ta.is_completed THEN 'true' ELSE 'false' END,
+                ta.assigned_date,
+                DATE(ta.due_date),
+                ta.completed_date,
+                ta.returned_date
+            FROM team_assignments ta
+            JOIN teams t ON ta.team_id = t.id
+            JOIN locations l ON ta.location_id = l.id
+            ORDER BY ta.team_id, ta.assigned_date, ta.id`)
+	}
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Location type tags derived from placemark descriptions.
+const (
+	LocationTypeDoorToDoor    = "door_to_door"
+	LocationTypeGPS           = "gps"
+	LocationTypeIndoorOutdoor = "indoor_outdoor"
+	LocationTypeIndoor        = "indoor"
+	LocationTypeOutdoor       = "outdoor"
+	LocationTypeCampus        = "campus"
+	LocationTypeMilitary      = "military"
+	LocationTypeChurch        = "church"
+	LocationTypeOther         = "other"
+)
+
+// placemarkDetails is the structured content of a placemark description.
+type placemarkDetails struct {
+	Address      string
+	Notes        string
+	LocationType string
+	MediaURLs    []string
+}
+
+var (
+	imgTagPattern   = regexp.MustCompile(`(?is)<img\b[^>]*>`)
+	imgSrcPattern   = regexp.MustCompile(`(?is)\bsrc\s*=\s*["']([^"']+)["']`)
+	lineBreakTag    = regexp.MustCompile(`(?is)<br\s*/?>|</?p\b[^>]*>|</?div\b[^>]*>`)
+	anyTagPattern   = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaceRunPattern = regexp.MustCompile(`[ \t]+`)
+
+	// A US street address: number, street words, city, state and ZIP, e.g.
+	// "701 Lynnhaven Pkwy, Virginia Beach, VA 23452".
+	addressPattern = regexp.MustCompile(`(?:^|\s)(\d+[A-Za-z]?(?:\s+[A-Za-z0-9.'#&-]+)+,\s*[A-Za-z .'-]+,\s*[A-Z]{2}\s+\d{5}(?:-\d{4})?)`)
+
+	doorToDoorPattern = regexp.MustCompile(`(?i)door\s*to\s*doo|first\s+(house|home|complex)`)
+	indoorPattern     = regexp.MustCompile(`(?i)\bin\s*door`)
+	outdoorPattern    = regexp.MustCompile(`(?i)\bout\s*door`)
+	gpsPattern        = regexp.MustCompile(`(?i)\bgps\b`)
+	campusPattern     = regexp.MustCompile(`(?i)\b(campus|college|university|students)\b`)
+	militaryPattern   = regexp.MustCompile(`(?i)\b(military|naval|base)\b`)
+	churchPattern     = regexp.MustCompile(`(?i)\bchurch\b`)
+)
+
+// parseDescription extracts the address, free-text notes, location type and
+// image URLs from a placemark description. Google My Maps exports these as
+// HTML inside CDATA; the XML decoder has already unwrapped the CDATA.
+func parseDescription(name, description string, mediaLinks []string) placemarkDetails {
+	var details placemarkDetails
+
+	text := imgTagPattern.ReplaceAllStringFunc(description, func(tag string) string {
+		if m := imgSrcPattern.FindStringSubmatch(tag); m != nil {
+			details.MediaURLs = append(details.MediaURLs, html.UnescapeString(m[1]))
+		}
+		return "\n"
+	})
+	text = lineBreakTag.ReplaceAllString(text, "\n")
+	text = anyTagPattern.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = strings.ReplaceAll(text, "\u00a0", " ")
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(spaceRunPattern.ReplaceAllString(line, " "))
+		if line == "" {
+			continue
+		}
+
+		if details.Address == "" {
+			if m := addressPattern.FindStringSubmatchIndex(line); m != nil {
+				details.Address = line[m[2]:m[3]]
+				// Keep whatever else was on the line, e.g. "; Lunch break".
+				line = strings.Trim(line[:m[2]]+" "+line[m[3]:], ";, ")
+				if line == "" {
+					continue
+				}
+			}
+		}
+		lines = append(lines, line)
+	}
+	details.Notes = strings.Join(lines, "\n")
+
+	details.MediaURLs = mergeMediaURLs(details.MediaURLs, mediaLinks)
+	details.LocationType = classifyLocation(name, details.Notes)
+	return details
+}
+
+// classifyLocation tags a location from keywords in its notes, falling back
+// to its name for the categories that are usually only named.
+func classifyLocation(name, notes string) string {
+	indoor, outdoor := indoorPattern.MatchString(notes), outdoorPattern.MatchString(notes)
+
+	switch {
+	case doorToDoorPattern.MatchString(notes):
+		return LocationTypeDoorToDoor
+	case gpsPattern.MatchString(notes):
+		return LocationTypeGPS
+	case indoor && outdoor:
+		return LocationTypeIndoorOutdoor
+	case indoor:
+		return LocationTypeIndoor
+	case outdoor:
+		return LocationTypeOutdoor
+	}
+
+	text := name + "\n" + notes
+	switch {
+	case campusPattern.MatchString(text):
+		return LocationTypeCampus
+	case militaryPattern.MatchString(text):
+		return LocationTypeMilitary
+	case churchPattern.MatchString(text):
+		return LocationTypeChurch
+	}
+	return LocationTypeOther
+}
+
+// mergeMediaURLs combines image URLs found in the description with the
+// whitespace-separated gx_media_links values, dropping duplicates.
+func mergeMediaURLs(fromDescription, mediaLinks []string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	add := func(url string) {
+		url = strings.TrimSpace(url)
+		if url != "" && !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+
+	for _, url := range fromDescription {
+		add(url)
+	}
+	for _, links := range mediaLinks {
+		for _, url := range strings.Fields(links) {
+			add(url)
+		}
+	}
+	return urls
+}
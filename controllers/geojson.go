@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"team-tracker-backend/geo"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// geoJSONFeature is a GeoJSON Feature. The geometry is kept raw so a single
+// malformed feature is reported instead of failing the whole file.
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	ID         interface{}            `json:"id,omitempty"`
+	Geometry   json.RawMessage        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Name     string           `json:"name,omitempty"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+// CreateGeoJSONImport accepts a multipart upload of a GeoJSON
+// FeatureCollection in the "file" field, as saved by QGIS and most other GIS
+// tools, and imports its features like CreateImport does placemarks.
+func CreateGeoJSONImport(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		upload, ok := readUpload(c, ".geojson", ".json")
+		if !ok {
+			return
+		}
+		defer upload.File.Close()
+
+		parsed, err := ParseGeoJSON(upload.File, upload.Fallback)
+		runImport(c, db, upload.Filename, "geojson", upload.DryRun, parsed, err)
+	}
+}
+
+// ParseGeoJSON reads a FeatureCollection. Each feature needs a name property;
+// description, region (a " / " separated path), address, notes,
+// location_type and media_urls are used when present, so a file written by
+// ExportLocationsGeoJSON imports back unchanged.
+//
+// An exported feature is matched on its own source and source_key
+// properties, so an exported file edited in QGIS updates the locations it
+// came from, whichever files they were imported from. A location made by a
+// split or merge has no source and is matched on the feature id instead.
+// Other features belong to the file's source: the features' common source
+// property if they have one, otherwise the collection name, or
+// fallbackSource.
+func ParseGeoJSON(r io.Reader, fallbackSource string) (*ParsedImport, error) {
+	var collection geoJSONFeatureCollection
+	if err := json.NewDecoder(r).Decode(&collection); err != nil {
+		return nil, fmt.Errorf("failed to parse GeoJSON: %v", err)
+	}
+	if collection.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("expected a GeoJSON FeatureCollection, got %q", collection.Type)
+	}
+
+	parsed := &ParsedImport{Format: "geojson"}
+	keys := make(map[string]int)
+	report := func(name, region, status, reason string) {
+		log.Printf("Feature %q %s: %s", name, status, reason)
+		parsed.Issues = append(parsed.Issues, ImportIssue{Name: name, Region: region, Status: status, Reason: reason})
+	}
+
+	sources := make(map[string]bool)
+	for i, f := range collection.Features {
+		props := f.Properties
+		// Names are kept as written so they match those imported from KML.
+		name, _ := props["name"].(string)
+		region := stringProperty(props, "region")
+		if strings.TrimSpace(name) == "" {
+			report(fmt.Sprintf("feature %d", i+1), region, IssueSkipped, "feature has no name property")
+			continue
+		}
+		if f.Type != "Feature" {
+			report(name, region, IssueInvalid, fmt.Sprintf("expected a Feature, got %q", f.Type))
+			continue
+		}
+		if len(f.Geometry) == 0 || string(f.Geometry) == "null" {
+			report(name, region, IssueSkipped, "feature has no geometry")
+			continue
+		}
+
+		var geometry geo.Geometry
+		if err := json.Unmarshal(f.Geometry, &geometry); err != nil {
+			report(name, region, IssueInvalid, fmt.Sprintf("invalid geometry: %v", err))
+			continue
+		}
+		if err := geometry.Validate(); err != nil {
+			report(name, region, IssueInvalid, fmt.Sprintf("invalid geometry: %v", err))
+			continue
+		}
+
+		var regionPath []string
+		for _, part := range strings.Split(region, " / ") {
+			if part = strings.TrimSpace(part); part != "" {
+				regionPath = append(regionPath, part)
+			}
+		}
+
+		// Exported features carry the source and key they were imported
+		// with. Those made by a split or merge carry a null source, and
+		// their id is the location's.
+		source := stringProperty(props, "source")
+		locationID := 0
+		if _, exported := props["source"]; exported && source == "" {
+			if id, ok := f.ID.(float64); ok && id > 0 && id == math.Trunc(id) {
+				locationID = int(id)
+			}
+		}
+		sourceKey := stringProperty(props, "source_key")
+		if sourceKey == "" {
+			sourceKey = recordKey(regionPath, featureID(f.ID), name, strings.ToLower(geometry.Type), keys)
+		}
+
+		description := stringProperty(props, "description")
+		details := parseDescription(name, description, mediaProperty(props["media_urls"]))
+		if _, ok := props["address"]; ok {
+			details.Address = stringProperty(props, "address")
+		}
+		if _, ok := props["notes"]; ok {
+			details.Notes = stringProperty(props, "notes")
+		}
+		if t := stringProperty(props, "location_type"); t != "" {
+			details.LocationType = t
+		}
+
+		if source != "" {
+			sources[source] = true
+		}
+		parsed.Records = append(parsed.Records, importedLocation{
+			Source:       source,
+			SourceKey:    sourceKey,
+			LocationID:   locationID,
+			RegionPath:   regionPath,
+			Name:         name,
+			Description:  description,
+			Address:      details.Address,
+			Notes:        details.Notes,
+			LocationType: details.LocationType,
+			MediaURLs:    details.MediaURLs,
+			Geometry:     geometry,
+		})
+	}
+
+	switch {
+	case len(sources) == 1:
+		for source := range sources {
+			parsed.Source = source
+		}
+	case strings.TrimSpace(collection.Name) != "":
+		parsed.Source = strings.TrimSpace(collection.Name)
+	default:
+		parsed.Source = fallbackSource
+	}
+
+	return parsed, nil
+}
+
+// stringProperty returns a feature property as trimmed text. GIS tools
+// sometimes turn text columns into numbers, so those are formatted back.
+func stringProperty(props map[string]interface{}, name string) string {
+	switch v := props[name].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// mediaProperty reads media_urls, which is an array in our own exports but a
+// whitespace-separated string once it has been through a shapefile or CSV.
+func mediaProperty(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var links []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				links = append(links, s)
+			}
+		}
+		return links
+	}
+	return nil
+}
+
+func featureID(id interface{}) string {
+	switch v := id.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// locationExportRow is an active location with the status fields reported by
+// /api/locations/status and the team it is currently assigned to.
+type locationExportRow struct {
+	ID               int     `db:"id"`
+	Name             string  `db:"name"`
+	Latitude         float64 `db:"latitude"`
+	Longitude        float64 `db:"longitude"`
+	Geometry         *string `db:"geometry"`
+	Source           *string `db:"source"`
+	SourceKey        *string `db:"source_key"`
+	RegionID         *int    `db:"region_id"`
+	Region           string  `db:"region"`
+	Description      string  `db:"description"`
+	Address          string  `db:"address"`
+	Notes            string  `db:"notes"`
+	LocationType     string  `db:"location_type"`
+	IsPreached       bool    `db:"is_preached"`
+	VisitCount       int     `db:"visit_count"`
+	LastVisit        string  `db:"last_visit"`
+	LastVisitTeam    *string `db:"last_visit_team"`
+	IsPlanned        bool    `db:"is_planned"`
+	AssignedTeamID   *int    `db:"assigned_team_id"`
+	AssignedTeamName *string `db:"assigned_team_name"`
+}
+
+// selectLocationExport loads every active location for the export
+// endpoints. Visits include those to the locations a location was split or
+// merged from. A location is preached when it is in the current campaign, the
+// assigned team is the most recent open assignment, and a location is
+// planned when a visit to it is scheduled for today or later, by the local
+// date planned visits are made for.
+func selectLocationExport(db *sqlx.DB) ([]locationExportRow, error) {
+	var rows []locationExportRow
+	err := db.Select(&rows, `
+        WITH RECURSIVE region_paths(id, path) AS (
+            SELECT id, name FROM regions WHERE parent_id IS NULL
+            UNION ALL
+            SELECT r.id, p.path || ' / ' || r.name
+            FROM regions r
+            JOIN region_paths p ON r.parent_id = p.id
+        ),
+        visits AS (
+            SELECT
+                l.id as location_id,
+                COUNT(*) as visit_count,
+                MAX(v.visit_date) as last_visit
+            FROM locations l
+            JOIN location_visits v ON v.location_id IN (`+LineageLocationIDs+`)
+            WHERE l.is_retired = FALSE
+            GROUP BY l.id
+        ),
+        open_assignments AS (
+            SELECT ta.location_id, ta.team_id, t.name,
+                   ROW_NUMBER() OVER (PARTITION BY ta.location_id ORDER BY ta.assigned_date DESC, ta.id DESC) as rn
+            FROM team_assignments ta
+            JOIN teams t ON t.id = ta.team_id
+            WHERE `+openAssignment+`
+        )
+        SELECT
+            l.id,
+            l.name,
+            l.latitude,
+            l.longitude,
+            l.geometry,
+            l.source,
+            l.source_key,
+            l.region_id,
+            COALESCE(rp.path, '') as region,
+            l.description,
+            l.address,
+            l.notes,
+            l.location_type,
+            l.is_preached,
+            COALESCE(v.visit_count, 0) as visit_count,
+            COALESCE(v.last_visit, '') as last_visit,
+            (SELECT t.name FROM location_visits lv
+             JOIN teams t ON t.id = lv.team_id
+             WHERE lv.location_id IN (`+LineageLocationIDs+`)
+             ORDER BY lv.visit_date DESC, lv.id DESC LIMIT 1) as last_visit_team,
+            EXISTS (SELECT 1 FROM planned_visits pv
+                    WHERE pv.location_id = l.id AND pv.status = 'planned'
+                      AND DATE(pv.planned_date) >= ?) as is_planned,
+            a.team_id as assigned_team_id,
+            a.name as assigned_team_name
+        FROM locations l
+        LEFT JOIN region_paths rp ON rp.id = l.region_id
+        LEFT JOIN visits v ON v.location_id = l.id
+        LEFT JOIN open_assignments a ON a.location_id = l.id AND a.rn = 1
+        WHERE l.is_retired = FALSE
+        ORDER BY l.id`, campaignDate())
+	return rows, err
+}
+
+// ExportLocationsGeoJSON writes every active location as a GeoJSON
+// FeatureCollection with its full geometry and visit status, for use in QGIS
+// and other GIS tools. The file can be edited and uploaded again through
+// CreateGeoJSONImport.
+func ExportLocationsGeoJSON(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rows, err := selectLocationExport(db)
+		if err != nil {
+			log.Printf("Error exporting locations: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export locations"})
+			return
+		}
+
+		media, err := loadMedia(db)
+		if err != nil {
+			log.Printf("Error exporting locations: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export locations"})
+			return
+		}
+
+		collection := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+		for _, row := range rows {
+			// The stored geometry is already GeoJSON.
+			var geometry json.RawMessage
+			if row.Geometry != nil && *row.Geometry != "" {
+				geometry = json.RawMessage(*row.Geometry)
+			} else {
+				geometry, _ = json.Marshal(geo.NewPoint(row.Longitude, row.Latitude))
+			}
+
+			mediaURLs := media[row.ID]
+			if mediaURLs == nil {
+				mediaURLs = []string{}
+			}
+
+			collection.Features = append(collection.Features, geoJSONFeature{
+				Type:     "Feature",
+				ID:       row.ID,
+				Geometry: geometry,
+				Properties: map[string]interface{}{
+					"name":               row.Name,
+					"source":             row.Source,
+					"source_key":         row.SourceKey,
+					"region":             row.Region,
+					"description":        row.Description,
+					"address":            row.Address,
+					"notes":              row.Notes,
+					"location_type":      row.LocationType,
+					"media_urls":         mediaURLs,
+					"latitude":           row.Latitude,
+					"longitude":          row.Longitude,
+					"is_preached":        row.IsPreached,
+					"visit_count":        row.VisitCount,
+					"last_visit":         row.LastVisit,
+					"status":             row.coverageStatus(),
+					"assigned_team_id":   row.AssignedTeamID,
+					"assigned_team_name": row.AssignedTeamName,
+				},
+			})
+		}
+
+		body, err := json.Marshal(collection)
+		if err != nil {
+			log.Printf("Error encoding locations export: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export locations"})
+			return
+		}
+
+		c.Header("Content-Disposition", `attachment; filename="locations.geojson"`)
+		c.Data(http.StatusOK, "application/geo+json", body)
+	}
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+type gpx struct {
+	XMLName   xml.Name      `xml:"http://www.topografix.com/GPX/1/1 gpx"`
+	Version   string        `xml:"version,attr"`
+	Creator   string        `xml:"creator,attr"`
+	Metadata  gpxMetadata   `xml:"metadata"`
+	Waypoints []gpxWaypoint `xml:"wpt"`
+	Route     gpxRoute      `xml:"rte"`
+}
+
+type gpxMetadata struct {
+	Name string    `xml:"name"`
+	Time time.Time `xml:"time"`
+}
+
+// gpxWaypoint is used for both wpt and rtept elements, which share a schema.
+type gpxWaypoint struct {
+	Lat     float64 `xml:"lat,attr"`
+	Lon     float64 `xml:"lon,attr"`
+	Name    string  `xml:"name"`
+	Comment string  `xml:"cmt,omitempty"`
+	Desc    string  `xml:"desc,omitempty"`
+	Type    string  `xml:"type,omitempty"`
+}
+
+type gpxRoute struct {
+	Name   string        `xml:"name"`
+	Points []gpxWaypoint `xml:"rtept"`
+}
+
+// plannedStop is a location on a team's plan for one day.
+type plannedStop struct {
+	PlannedVisitID int     `db:"planned_visit_id"`
+	Sequence       *int    `db:"sequence"`
+	LocationID     int     `db:"location_id"`
+	Name           string  `db:"name"`
+	Latitude       float64 `db:"latitude"`
+	Longitude      float64 `db:"longitude"`
+	Address        string  `db:"address"`
+	Notes          string  `db:"notes"`
+	LocationType   string  `db:"location_type"`
+}
+
+// selectPlannedStops loads a team's planned visits for one day in route
+// order: the sequence chosen by the route planner, then the order they were
+// planned in.
+func selectPlannedStops(db *sqlx.DB, teamID, date string) ([]plannedStop, error) {
+	var stops []plannedStop
+	err := db.Select(&stops, `
+        SELECT pv.id as planned_visit_id, pv.sequence,
+               l.id as location_id, l.name, l.latitude, l.longitude,
+               l.address, l.notes, l.location_type
+        FROM planned_visits pv
+        JOIN locations l ON pv.location_id = l.id
+        WHERE pv.team_id = ?
+        AND DATE(pv.planned_date) = DATE(?)
+        AND COALESCE(pv.status, 'planned') != 'cancelled'
+        ORDER BY pv.sequence IS NULL, pv.sequence, pv.id`, teamID, date)
+	return stops, err
+}
+
+// loadTeamPlan reads the team and date of a planned-route request and loads
+// the team's stops for that day. The date defaults to today. It writes an
+// error response and returns false if the team doesn't exist or has nothing
+// planned.
+func loadTeamPlan(c *gin.Context, db *sqlx.DB) (teamName, date string, stops []plannedStop, ok bool) {
+	teamID := c.Param("id")
+	date = c.DefaultQuery("date", time.Now().Format("2006-01-02"))
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, expected YYYY-MM-DD"})
+		return "", "", nil, false
+	}
+
+	err := db.Get(&teamName, "SELECT name FROM teams WHERE id = ?", teamID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		return "", "", nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch team"})
+		return "", "", nil, false
+	}
+
+	stops, err = selectPlannedStops(db, teamID, date)
+	if err != nil {
+		log.Printf("Error fetching planned route: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch planned visits"})
+		return "", "", nil, false
+	}
+	if len(stops) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No visits planned for " + date})
+		return "", "", nil, false
+	}
+	return teamName, date, stops, true
+}
+
+// GetPlannedRouteGPX returns a team's planned visits for one day as a GPX
+// file, with a waypoint per location and a route through them in planned
+// order, for loading into OsmAnd or a Garmin. Polygon territories are routed
+// to their centroid.
+func GetPlannedRouteGPX(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamName, date, stops, ok := loadTeamPlan(c, db)
+		if !ok {
+			return
+		}
+
+		title := fmt.Sprintf("%s - %s", teamName, date)
+		doc := gpx{
+			Version:  "1.1",
+			Creator:  "team-tracker",
+			Metadata: gpxMetadata{Name: title, Time: time.Now().UTC().Truncate(time.Second)},
+			Route:    gpxRoute{Name: title},
+		}
+		for i, stop := range stops {
+			desc := strings.TrimSpace(stop.Address + "\n" + stop.Notes)
+			doc.Waypoints = append(doc.Waypoints, gpxWaypoint{
+				Lat:     stop.Latitude,
+				Lon:     stop.Longitude,
+				Name:    stop.Name,
+				Comment: stop.Address,
+				Desc:    desc,
+				Type:    stop.LocationType,
+			})
+			doc.Route.Points = append(doc.Route.Points, gpxWaypoint{
+				Lat:  stop.Latitude,
+				Lon:  stop.Longitude,
+				Name: fmt.Sprintf("%d. %s", i+1, stop.Name),
+			})
+		}
+
+		body, err := xml.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			log.Printf("Error encoding GPX: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export route"})
+			return
+		}
+
+		filename := fmt.Sprintf("team-%s-%s.gpx", c.Param("id"), date)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Data(http.StatusOK, "application/gpx+xml", append([]byte(xml.Header), body...))
+	}
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// WorkTally counts how often a team or location turns up in the assignment
+// history: how often it was assigned, and how those assignments ended.
+type WorkTally struct {
+	ID             int    `json:"id" db:"id"`
+	Name           string `json:"name" db:"name"`
+	TimesAssigned  int    `json:"times_assigned" db:"times_assigned"`
+	TimesCompleted int    `json:"times_completed" db:"times_completed"`
+	TimesReturned  int    `json:"times_returned" db:"times_returned"`
+	FirstActivity  string `json:"first_activity" db:"first_activity"`
+	LastActivity   string `json:"last_activity" db:"last_activity"`
+}
+
+// workTallyColumns aggregates assignment_events aliased e. Inherited events
+// are left out of the counts; the assignments they continue are counted on
+// the location they came from.
+const workTallyColumns = `
+        SUM(e.action = 'assigned') as times_assigned,
+        SUM(e.action = 'completed') as times_completed,
+        SUM(e.action = 'returned') as times_returned,
+        strftime('%Y-%m-%dT%H:%M:%SZ', MIN(e.created_at)) as first_activity,
+        strftime('%Y-%m-%dT%H:%M:%SZ', MAX(e.created_at)) as last_activity`
+
+// AssignmentHistory is everything the history records about a location or a
+// team: totals, a tally per team or location, and every event oldest first.
+type AssignmentHistory struct {
+	TimesAssigned  int               `json:"times_assigned"`
+	TimesCompleted int               `json:"times_completed"`
+	TimesReturned  int               `json:"times_returned"`
+	Events         []AssignmentEvent `json:"events"`
+}
+
+func (h *AssignmentHistory) total(tallies []WorkTally) {
+	for _, t := range tallies {
+		h.TimesAssigned += t.TimesAssigned
+		h.TimesCompleted += t.TimesCompleted
+		h.TimesReturned += t.TimesReturned
+	}
+}
+
+type LocationAssignmentHistory struct {
+	LocationID   int    `json:"location_id"`
+	LocationName string `json:"location_name"`
+	// AncestorIDs are the locations this one was split or merged from, whose
+	// history it carries on.
+	AncestorIDs []int       `json:"ancestor_ids"`
+	Teams       []WorkTally `json:"teams"`
+	AssignmentHistory
+}
+
+// GetLocationAssignmentHistory returns who has worked a location and how
+// often, including the locations it was split or merged from.
+func GetLocationAssignmentHistory(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var history LocationAssignmentHistory
+		err := db.QueryRow("SELECT id, name FROM locations WHERE id = ?", id).Scan(&history.LocationID, &history.LocationName)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch location"})
+			return
+		}
+
+		history.AncestorIDs, err = locationAncestors(db, history.LocationID)
+		if err != nil {
+			log.Printf("Error fetching lineage of location %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignment history"})
+			return
+		}
+
+		locations := append([]int{history.LocationID}, history.AncestorIDs...)
+		history.Teams = []WorkTally{}
+		query, args, err := sqlx.In(`
+            SELECT
+                e.team_id as id,
+                (SELECT team_name FROM assignment_events n WHERE n.team_id = e.team_id ORDER BY n.id DESC LIMIT 1) as name,
+                `+workTallyColumns+`
+            FROM assignment_events e
+            WHERE e.location_id IN (?)
+            GROUP BY e.team_id
+            ORDER BY times_assigned DESC, last_activity DESC`, locations)
+		if err == nil {
+			err = db.Select(&history.Teams, query, args...)
+		}
+		if err == nil {
+			history.Events = []AssignmentEvent{}
+			query, args, err = sqlx.In(`
+                SELECT `+assignmentEventColumns+`
+                FROM assignment_events WHERE location_id IN (?)
+                ORDER BY created_at, id`, locations)
+			if err == nil {
+				err = db.Select(&history.Events, query, args...)
+			}
+		}
+		if err != nil {
+			log.Printf("Error fetching assignment history of location %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignment history"})
+			return
+		}
+
+		history.total(history.Teams)
+		c.JSON(http.StatusOK, history)
+	}
+}
+
+type TeamAssignmentHistory struct {
+	TeamID   int    `json:"team_id"`
+	TeamName string `json:"team_name"`
+	// Deleted is true for a team that no longer exists; its history remains.
+	Deleted   bool        `json:"deleted"`
+	Locations []WorkTally `json:"locations"`
+	AssignmentHistory
+}
+
+// GetTeamAssignmentHistory returns the locations a team has worked and how
+// often. It works for deleted teams too.
+func GetTeamAssignmentHistory(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var history TeamAssignmentHistory
+		err := db.QueryRow("SELECT id, name FROM teams WHERE id = ?", id).Scan(&history.TeamID, &history.TeamName)
+		if err == sql.ErrNoRows {
+			history.Deleted = true
+			err = db.QueryRow(`
+                SELECT team_id, team_name FROM assignment_events
+                WHERE team_id = ? ORDER BY id DESC LIMIT 1`, id).Scan(&history.TeamID, &history.TeamName)
+		}
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch team"})
+			return
+		}
+
+		history.Locations = []WorkTally{}
+		err = db.Select(&history.Locations, `
+            SELECT
+                e.location_id as id,
+                (SELECT location_name FROM assignment_events n WHERE n.location_id = e.location_id ORDER BY n.id DESC LIMIT 1) as name,
+                `+workTallyColumns+`
+            FROM assignment_events e
+            WHERE e.team_id = ?
+            GROUP BY e.location_id
+            ORDER BY times_assigned DESC, last_activity DESC`, history.TeamID)
+		if err == nil {
+			history.Events = []AssignmentEvent{}
+			err = db.Select(&history.Events, `
+                SELECT `+assignmentEventColumns+`
+                FROM assignment_events WHERE team_id = ?
+                ORDER BY created_at, id`, history.TeamID)
+		}
+		if err != nil {
+			log.Printf("Error fetching assignment history of team %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignment history"})
+			return
+		}
+
+		history.total(history.Locations)
+		c.JSON(http.StatusOK, history)
+	}
+}
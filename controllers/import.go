@@ -0,0 +1,501 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"team-tracker-backend/geo"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// importedLocation is a single location read from an import file, before it
+// has been matched against the locations table.
+type importedLocation struct {
+	// Source is the record's own source, as a GeoJSON export names for each
+	// feature; empty means the file's.
+	Source    string
+	SourceKey string
+	// LocationID matches a location made by a split or merge, which has no
+	// source of its own, when the record is an exported copy of it.
+	LocationID   int
+	RegionPath   []string
+	Name         string
+	Description  string
+	Address      string
+	Notes        string
+	LocationType string
+	MediaURLs    []string
+	Geometry     geo.Geometry
+}
+
+type ImportChange struct {
+	LocationID int    `json:"location_id"`
+	Name       string `json:"name"`
+	SourceKey  string `json:"source_key"`
+	Action     string `json:"action"` // 'added', 'updated', 'retired'
+}
+
+// Import issue statuses: skipped entries were deliberately left out, invalid
+// ones could not be read, and unsupported ones were imported without the
+// elements the parser doesn't handle.
+const (
+	IssueSkipped     = "skipped"
+	IssueInvalid     = "invalid"
+	IssueUnsupported = "unsupported"
+)
+
+// ImportIssue describes a placemark or feature that was not imported.
+type ImportIssue struct {
+	Name   string `json:"name"`
+	Region string `json:"region,omitempty"`
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+type ImportSummary struct {
+	Source    string         `json:"source"`
+	DryRun    bool           `json:"dry_run"`
+	Added     int            `json:"added"`
+	Updated   int            `json:"updated"`
+	Unchanged int            `json:"unchanged"`
+	Retired   int            `json:"retired"`
+	Skipped   int            `json:"skipped"`
+	Changes   []ImportChange `json:"changes"`
+	Issues    []ImportIssue  `json:"issues"`
+	// EmbeddedFiles lists images and other files packaged in a KMZ.
+	EmbeddedFiles []string `json:"embedded_files,omitempty"`
+	// Conflicts are overlaps and duplicates involving this source's
+	// locations once the import is applied.
+	Conflicts []LocationConflict `json:"conflicts"`
+}
+
+// ParsedImport is the result of reading an import file, ready to be applied
+// with ImportLocations.
+type ParsedImport struct {
+	Source  string
+	Format  string
+	Records []importedLocation
+	Issues  []ImportIssue
+	// EmbeddedFiles lists the non-KML entries of a KMZ archive.
+	EmbeddedFiles []string
+}
+
+// ImportLocations applies a parsed file to the locations table in one
+// transaction. With dryRun the transaction is rolled back, so the summary
+// shows what an import would change without changing anything.
+func ImportLocations(db *sqlx.DB, parsed *ParsedImport, dryRun bool) (*ImportSummary, error) {
+	// An empty file would otherwise retire every location from its source.
+	if len(parsed.Records) == 0 {
+		return nil, fmt.Errorf("no importable locations found in %s", parsed.Source)
+	}
+
+	// Start a transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Records naming their own source are applied with it, the rest with
+	// the file's.
+	var sources []string
+	bySource := make(map[string][]importedLocation)
+	for _, rec := range parsed.Records {
+		source := rec.Source
+		if source == "" {
+			source = parsed.Source
+		}
+		if _, ok := bySource[source]; !ok {
+			sources = append(sources, source)
+		}
+		bySource[source] = append(bySource[source], rec)
+	}
+
+	summary := &ImportSummary{Source: parsed.Source, Changes: []ImportChange{}, Issues: []ImportIssue{}}
+	for _, source := range sources {
+		applied, err := applyImport(tx, source, bySource[source])
+		if err != nil {
+			return nil, err
+		}
+		summary.add(applied)
+	}
+	summary.DryRun = dryRun
+	summary.Issues = append(append([]ImportIssue{}, parsed.Issues...), summary.Issues...)
+	for _, issue := range summary.Issues {
+		if issue.Status != IssueUnsupported {
+			summary.Skipped++
+		}
+	}
+	summary.EmbeddedFiles = parsed.EmbeddedFiles
+
+	summary.Conflicts, err = sourceConflicts(tx, sources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for conflicts: %v", err)
+	}
+
+	if !dryRun {
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %v", err)
+		}
+	}
+
+	log.Printf("%s import of %s complete (dry run: %t): %d added, %d updated, %d unchanged, %d retired, %d skipped, %d conflicts",
+		strings.ToUpper(parsed.Format), parsed.Source, dryRun,
+		summary.Added, summary.Updated, summary.Unchanged, summary.Retired, summary.Skipped, len(summary.Conflicts))
+
+	return summary, nil
+}
+
+// add counts the changes applied for another source into s.
+func (s *ImportSummary) add(other *ImportSummary) {
+	s.Added += other.Added
+	s.Updated += other.Updated
+	s.Unchanged += other.Unchanged
+	s.Retired += other.Retired
+	s.Changes = append(s.Changes, other.Changes...)
+	s.Issues = append(s.Issues, other.Issues...)
+}
+
+type existingLocation struct {
+	ID          int     `db:"id"`
+	Name        string  `db:"name"`
+	SourceKey   *string `db:"source_key"`
+	Description string  `db:"description"`
+	Address     string  `db:"address"`
+	Notes       string  `db:"notes"`
+	Type        string  `db:"location_type"`
+	Latitude    float64 `db:"latitude"`
+	Longitude   float64 `db:"longitude"`
+	Geometry    *string `db:"geometry"`
+	RegionID    *int    `db:"region_id"`
+	IsRetired   bool    `db:"is_retired"`
+}
+
+// applyImport reconciles the imported records for one source with the
+// locations table: new keys are inserted, changed rows are updated in place
+// and rows from the same source that are no longer present are retired.
+// Retired rows keep their id so visit history stays attached to them.
+func applyImport(tx *sqlx.Tx, source string, records []importedLocation) (*ImportSummary, error) {
+	summary := &ImportSummary{Source: source, Changes: []ImportChange{}, Issues: []ImportIssue{}}
+
+	var existing []existingLocation
+	err := tx.Select(&existing, `
+        SELECT id, name, source_key, description, address, notes, location_type,
+               latitude, longitude, geometry, region_id, is_retired
+        FROM locations
+        WHERE source = ?`, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load existing locations: %v", err)
+	}
+
+	byKey := make(map[string]existingLocation, len(existing))
+	for _, loc := range existing {
+		if loc.SourceKey != nil {
+			byKey[*loc.SourceKey] = loc
+		}
+	}
+
+	// Rows created before locations were keyed have no source; adopt them by
+	// name the first time the file they came from is imported.
+	var legacy []existingLocation
+	err = tx.Select(&legacy, `
+        SELECT id, name, source_key, description, address, notes, location_type,
+               latitude, longitude, geometry, region_id, is_retired
+        FROM locations
+        WHERE source IS NULL
+        AND id NOT IN (SELECT child_id FROM location_lineage)
+        ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load legacy locations: %v", err)
+	}
+	legacyByName := make(map[string][]existingLocation)
+	for _, loc := range legacy {
+		legacyByName[loc.Name] = append(legacyByName[loc.Name], loc)
+	}
+
+	// Locations made by a split or merge have no source; an exported copy of
+	// one is matched by its id.
+	var derived []existingLocation
+	err = tx.Select(&derived, `
+        SELECT id, name, source_key, description, address, notes, location_type,
+               latitude, longitude, geometry, region_id, is_retired
+        FROM locations
+        WHERE source IS NULL
+        AND id IN (SELECT child_id FROM location_lineage)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load split and merged locations: %v", err)
+	}
+	derivedByID := make(map[int]existingLocation, len(derived))
+	for _, loc := range derived {
+		derivedByID[loc.ID] = loc
+	}
+
+	// Locations that have been split or merged stay retired; their
+	// replacements carry on in their place.
+	var replaced []int
+	if err := tx.Select(&replaced, "SELECT DISTINCT parent_id FROM location_lineage"); err != nil {
+		return nil, fmt.Errorf("failed to load split and merged locations: %v", err)
+	}
+	isReplaced := make(map[int]bool, len(replaced))
+	for _, id := range replaced {
+		isReplaced[id] = true
+	}
+
+	media, err := loadMedia(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	regions := make(map[string]int)
+	seen := make(map[string]bool, len(records))
+	for _, rec := range records {
+		if seen[rec.SourceKey] {
+			log.Printf("Skipping duplicate placemark key %s", rec.SourceKey)
+			summary.Issues = append(summary.Issues, ImportIssue{
+				Name:   rec.Name,
+				Region: strings.Join(rec.RegionPath, " / "),
+				Status: IssueSkipped,
+				Reason: fmt.Sprintf("duplicate of an earlier entry with key %s", rec.SourceKey),
+			})
+			continue
+		}
+		seen[rec.SourceKey] = true
+
+		loc, ok := byKey[rec.SourceKey]
+		isDerived := false
+		if !ok && rec.LocationID != 0 {
+			loc, isDerived = derivedByID[rec.LocationID]
+			ok = isDerived
+		}
+		if !ok {
+			if candidates := legacyByName[rec.Name]; len(candidates) > 0 {
+				loc, ok = candidates[0], true
+				legacyByName[rec.Name] = candidates[1:]
+			}
+		}
+
+		geometry, err := json.Marshal(rec.Geometry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode geometry for %s: %v", rec.Name, err)
+		}
+		// A split or merged location keeps its region, which belongs to
+		// another source, and stays without a source of its own.
+		rowSource, rowKey := &source, &rec.SourceKey
+		regionID := loc.RegionID
+		if isDerived {
+			rowSource, rowKey = nil, nil
+		} else if regionID, err = resolveRegion(tx, source, rec.RegionPath, regions); err != nil {
+			return nil, err
+		}
+		center := rec.Geometry.Centroid()
+		locationType := rec.LocationType
+		if locationType == "" {
+			locationType = LocationTypeOther
+		}
+		row := locationRow{
+			RegionID:     regionID,
+			Name:         rec.Name,
+			Description:  rec.Description,
+			Address:      rec.Address,
+			Notes:        rec.Notes,
+			LocationType: locationType,
+			Latitude:     center.Lat(),
+			Longitude:    center.Lon(),
+			Geometry:     string(geometry),
+			AreaM2:       rec.Geometry.Area(),
+			PerimeterM:   rec.Geometry.Perimeter(),
+			MediaURLs:    rec.MediaURLs,
+		}
+
+		if !ok {
+			result, err := tx.Exec(`
+                INSERT INTO locations
+                (name, latitude, longitude, geometry, area_m2, perimeter_m, description, address,
+                 notes, location_type, region_id, source, source_key)
+                VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				row.Name, row.Latitude, row.Longitude, row.Geometry, row.AreaM2, row.PerimeterM,
+				row.Description, row.Address, row.Notes, row.LocationType, row.RegionID, source, rec.SourceKey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to insert location %s: %v", rec.Name, err)
+			}
+			id, _ := result.LastInsertId()
+			if err := replaceMedia(tx, int(id), row.MediaURLs); err != nil {
+				return nil, err
+			}
+			log.Printf("Inserted location: Name=%s, Latitude=%f, Longitude=%f", row.Name, row.Latitude, row.Longitude)
+			summary.Added++
+			summary.Changes = append(summary.Changes, ImportChange{
+				LocationID: int(id), Name: rec.Name, SourceKey: rec.SourceKey, Action: "added",
+			})
+			continue
+		}
+
+		if isReplaced[loc.ID] {
+			summary.Unchanged++
+			continue
+		}
+
+		keyed := isDerived || (loc.SourceKey != nil && *loc.SourceKey == rec.SourceKey)
+		if keyed && !loc.IsRetired && !locationChanged(loc, media[loc.ID], row) {
+			summary.Unchanged++
+			continue
+		}
+
+		_, err = tx.Exec(`
+            UPDATE locations
+            SET name = ?, latitude = ?, longitude = ?, geometry = ?, area_m2 = ?, perimeter_m = ?,
+                description = ?, address = ?, notes = ?, location_type = ?, region_id = ?,
+                source = ?, source_key = ?, is_retired = FALSE, retired_at = NULL
+            WHERE id = ?`,
+			row.Name, row.Latitude, row.Longitude, row.Geometry, row.AreaM2, row.PerimeterM, row.Description,
+			row.Address, row.Notes, row.LocationType, row.RegionID,
+			rowSource, rowKey, loc.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update location %s: %v", rec.Name, err)
+		}
+		if err := replaceMedia(tx, loc.ID, row.MediaURLs); err != nil {
+			return nil, err
+		}
+
+		// Adopting a legacy row only attaches a key; it is not a content change.
+		if !keyed && !locationChanged(loc, media[loc.ID], row) {
+			summary.Unchanged++
+			continue
+		}
+		log.Printf("Updated location: Name=%s, Latitude=%f, Longitude=%f", row.Name, row.Latitude, row.Longitude)
+		summary.Updated++
+		change := ImportChange{LocationID: loc.ID, Name: rec.Name, SourceKey: rec.SourceKey, Action: "updated"}
+		if isDerived {
+			change.SourceKey = ""
+		}
+		summary.Changes = append(summary.Changes, change)
+	}
+
+	for _, loc := range existing {
+		if loc.IsRetired || loc.SourceKey == nil || seen[*loc.SourceKey] {
+			continue
+		}
+
+		_, err := tx.Exec(`
+            UPDATE locations SET is_retired = TRUE, retired_at = CURRENT_TIMESTAMP
+            WHERE id = ?`, loc.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retire location %s: %v", loc.Name, err)
+		}
+		log.Printf("Retired location: Name=%s", loc.Name)
+		summary.Retired++
+		summary.Changes = append(summary.Changes, ImportChange{
+			LocationID: loc.ID, Name: loc.Name, SourceKey: *loc.SourceKey, Action: "retired",
+		})
+	}
+
+	return summary, nil
+}
+
+// coordinateEpsilon is well below the precision Google My Maps exports, so
+// float noise never registers as a moved placemark.
+const coordinateEpsilon = 1e-9
+
+// locationRow holds the column values written for an imported location.
+type locationRow struct {
+	RegionID     *int
+	Name         string
+	Description  string
+	Address      string
+	Notes        string
+	LocationType string
+	Latitude     float64
+	Longitude    float64
+	Geometry     string
+	AreaM2       float64
+	PerimeterM   float64
+	MediaURLs    []string
+}
+
+func locationChanged(loc existingLocation, media []string, row locationRow) bool {
+	return loc.Name != row.Name ||
+		loc.Description != row.Description ||
+		loc.Address != row.Address ||
+		loc.Notes != row.Notes ||
+		loc.Type != row.LocationType ||
+		strings.Join(media, "\n") != strings.Join(row.MediaURLs, "\n") ||
+		loc.Geometry == nil || *loc.Geometry != row.Geometry ||
+		!sameRegion(loc.RegionID, row.RegionID) ||
+		math.Abs(loc.Latitude-row.Latitude) > coordinateEpsilon ||
+		math.Abs(loc.Longitude-row.Longitude) > coordinateEpsilon
+}
+
+// loadMedia returns the media URLs of every location, in display order.
+func loadMedia(q sqlx.Queryer) (map[int][]string, error) {
+	var rows []struct {
+		LocationID int    `db:"location_id"`
+		URL        string `db:"url"`
+	}
+	if err := sqlx.Select(q, &rows, "SELECT location_id, url FROM location_media ORDER BY location_id, position"); err != nil {
+		return nil, fmt.Errorf("failed to load location media: %v", err)
+	}
+
+	media := make(map[int][]string)
+	for _, r := range rows {
+		media[r.LocationID] = append(media[r.LocationID], r.URL)
+	}
+	return media, nil
+}
+
+func replaceMedia(tx *sqlx.Tx, locationID int, urls []string) error {
+	if _, err := tx.Exec("DELETE FROM location_media WHERE location_id = ?", locationID); err != nil {
+		return fmt.Errorf("failed to clear media for location %d: %v", locationID, err)
+	}
+	for i, url := range urls {
+		_, err := tx.Exec("INSERT INTO location_media (location_id, url, position) VALUES (?, ?, ?)", locationID, url, i)
+		if err != nil {
+			return fmt.Errorf("failed to store media for location %d: %v", locationID, err)
+		}
+	}
+	return nil
+}
+
+func sameRegion(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// resolveRegion returns the id of the region for a folder path, creating it
+// and any missing ancestors. Regions are keyed by source and path so
+// re-importing the same file reuses them. Ids are cached by path in known.
+func resolveRegion(tx *sqlx.Tx, source string, path []string, known map[string]int) (*int, error) {
+	var parentID *int
+	for depth := range path {
+		key := strings.Join(path[:depth+1], "/")
+		if id, ok := known[key]; ok {
+			parentID = &id
+			continue
+		}
+
+		var id int
+		err := tx.Get(&id, "SELECT id FROM regions WHERE source = ? AND source_key = ?", source, key)
+		if err == sql.ErrNoRows {
+			result, err := tx.Exec(`
+                INSERT INTO regions (name, parent_id, source, source_key)
+                VALUES (?, ?, ?, ?)`, path[depth], parentID, source, key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create region %s: %v", key, err)
+			}
+			lastID, _ := result.LastInsertId()
+			id = int(lastID)
+			log.Printf("Created region: %s", key)
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to look up region %s: %v", key, err)
+		}
+
+		known[key] = id
+		parentID = &id
+	}
+	return parentID, nil
+}
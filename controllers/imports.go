@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// maxImportSize caps uploaded territory files. The full Hampton Roads KML is
+// about 250 KB, so this leaves plenty of room for KMZ files with photos.
+const maxImportSize = 50 << 20
+
+type ImportRecord struct {
+	ID        int            `json:"id" db:"id"`
+	Filename  string         `json:"filename" db:"filename"`
+	Format    string         `json:"format" db:"format"`
+	Source    *string        `json:"source" db:"source"`
+	DryRun    bool           `json:"dry_run" db:"dry_run"`
+	Status    string         `json:"status" db:"status"` // 'completed', 'failed'
+	Added     int            `json:"added" db:"added"`
+	Updated   int            `json:"updated" db:"updated"`
+	Unchanged int            `json:"unchanged" db:"unchanged"`
+	Retired   int            `json:"retired" db:"retired"`
+	Skipped   int            `json:"skipped" db:"skipped"`
+	Error     *string        `json:"error,omitempty" db:"error"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+	Report    *ImportSummary `json:"report,omitempty" db:"-"`
+}
+
+// CreateImport accepts a multipart upload of a .kml or .kmz file in the
+// "file" field and imports its placemarks. With dry_run=true nothing is
+// written to locations, but the import and its report are still recorded.
+func CreateImport(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		upload, ok := readUpload(c, ".kml", ".kmz")
+		if !ok {
+			return
+		}
+		defer upload.File.Close()
+
+		var parsed *ParsedImport
+		var err error
+		if upload.Ext == ".kmz" {
+			var data []byte
+			data, err = io.ReadAll(upload.File)
+			if err == nil {
+				parsed, err = ParseKMZ(data, upload.Fallback)
+			}
+		} else {
+			parsed, err = ParseKML(upload.File, upload.Fallback)
+		}
+
+		runImport(c, db, upload.Filename, strings.TrimPrefix(upload.Ext, "."), upload.DryRun, parsed, err)
+	}
+}
+
+// upload is a territory file posted to one of the import endpoints.
+type upload struct {
+	Filename string
+	Ext      string
+	// Fallback names the source when the file doesn't name itself.
+	Fallback string
+	DryRun   bool
+	File     multipart.File
+}
+
+// readUpload opens the "file" field of a multipart upload and reads the
+// dry_run flag. If either is unusable it writes a 400 response and returns
+// false.
+func readUpload(c *gin.Context, extensions ...string) (*upload, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return nil, false
+	}
+
+	dryRun, err := parseDryRun(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dry_run value"})
+		return nil, false
+	}
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	supported := false
+	for _, e := range extensions {
+		supported = supported || ext == e
+	}
+	if !supported {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported file type, expected " + strings.Join(extensions, " or ")})
+		return nil, false
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+		return nil, false
+	}
+
+	return &upload{
+		Filename: header.Filename,
+		Ext:      ext,
+		Fallback: strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename)),
+		DryRun:   dryRun,
+		File:     file,
+	}, true
+}
+
+// runImport applies a parsed upload, records the outcome in the imports
+// table and writes the response. parseErr is the error from reading the
+// upload, if any, so parse failures are recorded like any other.
+func runImport(c *gin.Context, db *sqlx.DB, filename, format string, dryRun bool, parsed *ParsedImport, parseErr error) {
+	record := ImportRecord{Filename: filename, Format: format, DryRun: dryRun}
+
+	err := parseErr
+	if err == nil {
+		record.Source = &parsed.Source
+		record.Report, err = ImportLocations(db, parsed, dryRun)
+	}
+
+	if err != nil {
+		log.Printf("Import of %s failed: %v", filename, err)
+		message := err.Error()
+		record.Status = "failed"
+		record.Error = &message
+		if saveErr := saveImport(db, &record); saveErr != nil {
+			log.Printf("Error recording failed import: %v", saveErr)
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": message, "import": record})
+		return
+	}
+
+	record.Status = "completed"
+	if err := saveImport(db, &record); err != nil {
+		log.Printf("Error recording import: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Import applied but could not be recorded"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, record)
+}
+
+func saveImport(db *sqlx.DB, record *ImportRecord) error {
+	var report []byte
+	if record.Report != nil {
+		var err error
+		report, err = json.Marshal(record.Report)
+		if err != nil {
+			return fmt.Errorf("failed to encode import report: %v", err)
+		}
+		record.Added = record.Report.Added
+		record.Updated = record.Report.Updated
+		record.Unchanged = record.Report.Unchanged
+		record.Retired = record.Report.Retired
+		record.Skipped = record.Report.Skipped
+	}
+
+	record.CreatedAt = time.Now()
+	result, err := db.Exec(`
+        INSERT INTO imports
+        (filename, format, source, dry_run, status, added, updated, unchanged, retired, skipped, error, report, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.Filename, record.Format, record.Source, record.DryRun, record.Status,
+		record.Added, record.Updated, record.Unchanged, record.Retired, record.Skipped,
+		record.Error, string(report), record.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	record.ID = int(id)
+	return nil
+}
+
+func parseDryRun(c *gin.Context) (bool, error) {
+	value := c.Query("dry_run")
+	if value == "" {
+		value = c.PostForm("dry_run")
+	}
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+const importColumns = `id, filename, format, source, dry_run, status,
+    added, updated, unchanged, retired, skipped, error, created_at`
+
+// GetImports lists past imports, newest first, without their reports.
+func GetImports(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		imports := []ImportRecord{}
+		err := db.Select(&imports, "SELECT "+importColumns+" FROM imports ORDER BY id DESC")
+		if err != nil {
+			log.Printf("Error fetching imports: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch imports"})
+			return
+		}
+		c.JSON(http.StatusOK, imports)
+	}
+}
+
+// GetImport returns one import with its per-placemark report.
+func GetImport(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var row struct {
+			ImportRecord
+			RawReport *string `db:"report"`
+		}
+
+		err := db.Get(&row, "SELECT "+importColumns+", report FROM imports WHERE id = ?", id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch import"})
+			return
+		}
+
+		record := row.ImportRecord
+		if row.RawReport != nil && *row.RawReport != "" {
+			var report ImportSummary
+			if err := json.Unmarshal([]byte(*row.RawReport), &report); err != nil {
+				log.Printf("Invalid report stored for import %d: %v", record.ID, err)
+			} else {
+				record.Report = &report
+			}
+		}
+
+		c.JSON(http.StatusOK, record)
+	}
+}
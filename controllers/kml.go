@@ -1,12 +1,18 @@
 package controllers
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"team-tracker-backend/geo"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -18,118 +24,254 @@ type KML struct {
 }
 
 type Document struct {
-	Folders    []Folder    `xml:"Folder"`
-	Placemarks []Placemark `xml:"Placemark"`
+	Name       string       `xml:"name"`
+	Folders    []Folder     `xml:"Folder"`
+	Placemarks []Placemark  `xml:"Placemark"`
+	Other      []kmlElement `xml:",any"`
 }
 
 type Folder struct {
-	Name       string      `xml:"name"`
-	Placemarks []Placemark `xml:"Placemark"`
+	Name       string       `xml:"name"`
+	Folders    []Folder     `xml:"Folder"`
+	Placemarks []Placemark  `xml:"Placemark"`
+	Other      []kmlElement `xml:",any"`
 }
 
 type Placemark struct {
-	Name        string   `xml:"name"`
-	Description string   `xml:"description"`
-	Point       *Point   `xml:"Point"`
-	Polygon     *Polygon `xml:"Polygon"`
+	ID           string        `xml:"id,attr"`
+	Name         string        `xml:"name"`
+	Description  string        `xml:"description"`
+	ExtendedData *ExtendedData `xml:"ExtendedData"`
+	Geometries
+	Other []kmlElement `xml:",any"`
 }
 
-type Point struct {
-	Coordinates string `xml:"coordinates"`
+type ExtendedData struct {
+	Data []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value"`
+	} `xml:"Data"`
 }
 
-type Polygon struct {
-	OuterBoundaryIs struct {
-		LinearRing struct {
-			Coordinates string `xml:"coordinates"`
-		} `xml:"LinearRing"`
-	} `xml:"outerBoundaryIs"`
+// MediaLinks returns the gx_media_links values Google My Maps uses for
+// photos attached to a placemark.
+func (p Placemark) MediaLinks() []string {
+	if p.ExtendedData == nil {
+		return nil
+	}
+
+	var links []string
+	for _, d := range p.ExtendedData.Data {
+		if d.Name == "gx_media_links" {
+			links = append(links, d.Value)
+		}
+	}
+	return links
 }
 
-func PopulateLocations(db *sqlx.DB, filePath string) error {
+// PopulateLocations imports the placemarks in a KML file. It can be run
+// repeatedly against the same file: placemarks are matched to existing rows
+// by their folder and name (or KML id), so only real changes are written.
+func PopulateLocations(db *sqlx.DB, filePath string) (*ImportSummary, error) {
 	log.Printf("Opening KML file: %s", filePath)
 	file, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open KML file: %v", err)
+		return nil, fmt.Errorf("failed to open KML file: %v", err)
 	}
 	defer file.Close()
 
+	fallback := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	parsed, err := ParseKML(file, fallback)
+	if err != nil {
+		return nil, err
+	}
+
+	return ImportLocations(db, parsed, false)
+}
+
+// ParseKML reads a KML document. Placemarks that cannot be imported are
+// reported in Issues rather than failing the whole file. The document name
+// identifies the source; fallbackSource is used when it has none.
+func ParseKML(r io.Reader, fallbackSource string) (*ParsedImport, error) {
 	// Parse the KML file
 	var kml KML
-	decoder := xml.NewDecoder(file)
+	decoder := xml.NewDecoder(r)
 	if err := decoder.Decode(&kml); err != nil {
-		return fmt.Errorf("failed to parse KML: %v", err)
+		return nil, fmt.Errorf("failed to parse KML: %v", err)
 	}
 
-	// Start a transaction
-	tx, err := db.Beginx()
-	if err != nil {
-		return fmt.Errorf("failed to start transaction: %v", err)
+	source := strings.TrimSpace(kml.Document.Name)
+	if source == "" {
+		source = fallbackSource
 	}
-	defer tx.Rollback()
 
-	// Prepare statement
-	stmt, err := tx.Preparex("INSERT INTO locations (name, latitude, longitude) VALUES (?, ?, ?)")
+	// Process document-level placemarks, then placemarks in folders
+	parser := &kmlParser{keys: make(map[string]int)}
+	parser.processPlacemarks(nil, kml.Document.Placemarks)
+	parser.reportUnsupportedFeatures(nil, kml.Document.Other)
+	for _, folder := range kml.Document.Folders {
+		parser.processFolder(nil, folder)
+	}
+
+	return &ParsedImport{
+		Source:  source,
+		Format:  "kml",
+		Records: parser.records,
+		Issues:  parser.issues,
+	}, nil
+}
+
+// ParseKMZ reads a KMZ archive: a zip holding a KML document (doc.kml by
+// convention) and the images it references.
+func ParseKMZ(data []byte, fallbackSource string) (*ParsedImport, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
 	if err != nil {
-		return fmt.Errorf("failed to prepare statement: %v", err)
+		return nil, fmt.Errorf("failed to open KMZ archive: %v", err)
 	}
-	defer stmt.Close()
 
-	// Process document-level placemarks
-	processPlacemarks(kml.Document.Placemarks, stmt)
+	var doc *zip.File
+	var embedded []string
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		isKML := strings.EqualFold(path.Ext(f.Name), ".kml")
+		switch {
+		case isKML && (doc == nil || f.Name == "doc.kml"):
+			if doc != nil {
+				embedded = append(embedded, doc.Name)
+			}
+			doc = f
+		default:
+			embedded = append(embedded, f.Name)
+		}
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("KMZ archive contains no KML document")
+	}
 
-	// Process placemarks in folders
-	for _, folder := range kml.Document.Folders {
-		log.Printf("Processing folder: %s", folder.Name)
-		processPlacemarks(folder.Placemarks, stmt)
+	rc, err := doc.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from KMZ: %v", doc.Name, err)
 	}
+	defer rc.Close()
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
+	parsed, err := ParseKML(rc, fallbackSource)
+	if err != nil {
+		return nil, err
 	}
+	parsed.Format = "kmz"
+	parsed.EmbeddedFiles = embedded
+	return parsed, nil
+}
+
+// kmlParser turns placemarks into import records, collecting an issue for
+// each placemark it has to leave out.
+type kmlParser struct {
+	keys    map[string]int
+	records []importedLocation
+	issues  []ImportIssue
+}
 
-	// Verify the count
-	var count int
-	if err := db.Get(&count, "SELECT COUNT(*) FROM locations"); err != nil {
-		log.Printf("Error counting locations: %v", err)
-	} else {
-		log.Printf("Successfully imported %d locations", count)
+func (kp *kmlParser) report(regionPath []string, name, status, reason string) {
+	log.Printf("Placemark %q %s: %s", name, status, reason)
+	kp.issues = append(kp.issues, ImportIssue{
+		Name:   name,
+		Region: strings.Join(regionPath, " / "),
+		Status: status,
+		Reason: reason,
+	})
+}
+
+// reportUnsupportedFeatures records the features in a document or folder
+// that aren't placemarks, such as overlays and network links.
+func (kp *kmlParser) reportUnsupportedFeatures(regionPath []string, elements []kmlElement) {
+	for _, el := range elements {
+		if unsupportedFeatures[el.XMLName.Local] {
+			kp.report(regionPath, el.XMLName.Local, IssueSkipped, el.XMLName.Local+" features are not supported")
+		}
 	}
+}
 
-	return nil
+// processFolder collects the placemarks in a folder and, recursively, in its
+// subfolders. Each folder becomes a region nested under its parent.
+func (kp *kmlParser) processFolder(parent []string, folder Folder) {
+	path := append(append([]string{}, parent...), strings.TrimSpace(folder.Name))
+	log.Printf("Processing folder: %s", strings.Join(path, " / "))
+
+	kp.processPlacemarks(path, folder.Placemarks)
+	kp.reportUnsupportedFeatures(path, folder.Other)
+	for _, sub := range folder.Folders {
+		kp.processFolder(path, sub)
+	}
 }
 
-func processPlacemarks(placemarks []Placemark, stmt *sqlx.Stmt) {
+func (kp *kmlParser) processPlacemarks(regionPath []string, placemarks []Placemark) {
 	for _, p := range placemarks {
 		// Skip if name is empty
-		if p.Name == "" {
+		if strings.TrimSpace(p.Name) == "" {
+			kp.report(regionPath, p.Name, IssueSkipped, "placemark has no name")
 			continue
 		}
 
-		// Process Point placemark
-		if p.Point != nil && p.Point.Coordinates != "" {
-			coords := extractCoordinates(p.Point.Coordinates)
-			if coords != nil {
-				insertLocation(stmt, p.Name, coords[1], coords[0]) // lat, lon
-			}
+		var parts []geo.Geometry
+		var unsupported []string
+		if err := p.Geometries.collect(&parts, &unsupported); err != nil {
+			kp.report(regionPath, p.Name, IssueInvalid, err.Error())
 			continue
 		}
+		for _, other := range p.Other {
+			if !placemarkChildren[other.XMLName.Local] {
+				unsupported = append(unsupported, other.XMLName.Local)
+			}
+		}
 
-		// Process Polygon placemark - use first coordinate as center point
-		if p.Polygon != nil {
-			coords := p.Polygon.OuterBoundaryIs.LinearRing.Coordinates
-			if coords != "" {
-				// Take the first coordinate pair as the reference point
-				coordPairs := strings.Split(strings.TrimSpace(coords), "\n")
-				if len(coordPairs) > 0 {
-					firstCoord := extractCoordinates(coordPairs[0])
-					if firstCoord != nil {
-						insertLocation(stmt, p.Name, firstCoord[1], firstCoord[0]) // lat, lon
-					}
-				}
+		if len(parts) == 0 {
+			reason := "placemark has no geometry"
+			if len(unsupported) > 0 {
+				reason = "placemark has no supported geometry, found " + strings.Join(unsupported, ", ")
 			}
+			kp.report(regionPath, p.Name, IssueSkipped, reason)
+			continue
 		}
+		if len(unsupported) > 0 {
+			kp.report(regionPath, p.Name, IssueUnsupported,
+				"imported without unsupported elements: "+strings.Join(unsupported, ", "))
+		}
+
+		geometry := geo.Collect(parts)
+		kind := strings.ToLower(geometry.Type)
+
+		details := parseDescription(p.Name, p.Description, p.MediaLinks())
+		kp.records = append(kp.records, importedLocation{
+			SourceKey:    recordKey(regionPath, p.ID, p.Name, kind, kp.keys),
+			RegionPath:   regionPath,
+			Name:         p.Name,
+			Description:  strings.TrimSpace(p.Description),
+			Address:      details.Address,
+			Notes:        details.Notes,
+			LocationType: details.LocationType,
+			MediaURLs:    details.MediaURLs,
+			Geometry:     geometry,
+		})
+	}
+}
+
+// recordKey builds the stable identity used to match a placemark or feature
+// on re-import. The file's own id is used when present; otherwise the folder
+// path, name and geometry kind, with a counter for the rare entries that
+// share all three.
+func recordKey(regionPath []string, id, name, kind string, keys map[string]int) string {
+	if id != "" {
+		return "id:" + id
 	}
+
+	key := strings.Join(regionPath, "/") + "/" + strings.TrimSpace(name) + "#" + kind
+	keys[key]++
+	if n := keys[key]; n > 1 {
+		key = fmt.Sprintf("%s-%d", key, n)
+	}
+	return key
 }
 
 func extractCoordinates(coordStr string) []float64 {
@@ -152,12 +294,3 @@ func extractCoordinates(coordStr string) []float64 {
 
 	return []float64{lon, lat}
 }
-
-func insertLocation(stmt *sqlx.Stmt, name string, lat, lon float64) {
-	_, err := stmt.Exec(name, lat, lon)
-	if err != nil {
-		log.Printf("Failed to insert location %s: %v", name, err)
-	} else {
-		log.Printf("Inserted location: Name=%s, Latitude=%f, Longitude=%f", name, lat, lon)
-	}
-}
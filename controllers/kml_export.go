@@ -0,0 +1,271 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"team-tracker-backend/geo"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Coverage states shown in exports, from least to most complete.
+const (
+	CoverageUnvisited = "unvisited"
+	CoverageAssigned  = "assigned"
+	CoveragePlanned   = "planned"
+	CoveragePreached  = "preached"
+)
+
+// coverageStatus is the most complete state the location has reached.
+func (row locationExportRow) coverageStatus() string {
+	switch {
+	case row.IsPreached:
+		return CoveragePreached
+	case row.IsPlanned:
+		return CoveragePlanned
+	case row.AssignedTeamID != nil:
+		return CoverageAssigned
+	}
+	return CoverageUnvisited
+}
+
+// coverageStyles are the KML colors (aabbggrr) for each coverage state.
+// Polygons are filled with the same color at half opacity.
+var coverageStyles = []struct {
+	Status string
+	Color  string
+}{
+	{CoverageUnvisited, "ff3c14dc"}, // red
+	{CoverageAssigned, "ff00d7ff"},  // amber
+	{CoveragePlanned, "ffe16941"},   // blue
+	{CoveragePreached, "ff32cd32"},  // green
+}
+
+type kmlExport struct {
+	XMLName  xml.Name          `xml:"http://www.opengis.net/kml/2.2 kml"`
+	Document kmlExportDocument `xml:"Document"`
+}
+
+type kmlExportDocument struct {
+	Name       string               `xml:"name"`
+	Styles     []kmlStyle           `xml:"Style"`
+	Folders    []kmlExportFolder    `xml:"Folder"`
+	Placemarks []kmlExportPlacemark `xml:"Placemark"`
+}
+
+type kmlExportFolder struct {
+	Name       string               `xml:"name"`
+	Folders    []kmlExportFolder    `xml:"Folder"`
+	Placemarks []kmlExportPlacemark `xml:"Placemark"`
+}
+
+type kmlExportPlacemark struct {
+	ID          string   `xml:"id,attr"`
+	Name        string   `xml:"name"`
+	Description kmlCDATA `xml:"description"`
+	StyleURL    string   `xml:"styleUrl"`
+	Geometries
+}
+
+type kmlCDATA struct {
+	Text string `xml:",cdata"`
+}
+
+type kmlStyle struct {
+	ID        string `xml:"id,attr"`
+	IconStyle struct {
+		Color string `xml:"color"`
+	} `xml:"IconStyle"`
+	LineStyle struct {
+		Color string  `xml:"color"`
+		Width float64 `xml:"width"`
+	} `xml:"LineStyle"`
+	PolyStyle struct {
+		Color string `xml:"color"`
+	} `xml:"PolyStyle"`
+}
+
+// ExportTerritoriesKML writes every active location as a KML placemark with
+// its original geometry, styled by coverage state and grouped into folders
+// by region, for sharing progress in Google Earth.
+func ExportTerritoriesKML(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rows, err := selectLocationExport(db)
+		if err != nil {
+			log.Printf("Error exporting territories: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export territories"})
+			return
+		}
+
+		var regions []struct {
+			ID       int    `db:"id"`
+			Name     string `db:"name"`
+			ParentID *int   `db:"parent_id"`
+		}
+		if err := db.Select(&regions, "SELECT id, name, parent_id FROM regions ORDER BY id"); err != nil {
+			log.Printf("Error exporting territories: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export territories"})
+			return
+		}
+
+		doc := kmlExportDocument{Name: "Territory coverage"}
+		for _, s := range coverageStyles {
+			style := kmlStyle{ID: "status-" + s.Status}
+			style.IconStyle.Color = s.Color
+			style.LineStyle.Color = s.Color
+			style.LineStyle.Width = 2
+			style.PolyStyle.Color = "7f" + s.Color[2:]
+			doc.Styles = append(doc.Styles, style)
+		}
+
+		byRegion := make(map[int][]kmlExportPlacemark)
+		for _, row := range rows {
+			geometry, err := decodeGeometry(row.Geometry, row.Latitude, row.Longitude)
+			if err != nil {
+				log.Printf("Invalid geometry stored for location %d: %v", row.ID, err)
+				geometry = geo.NewPoint(row.Longitude, row.Latitude)
+			}
+
+			placemark := kmlExportPlacemark{
+				ID:          fmt.Sprintf("location-%d", row.ID),
+				Name:        row.Name,
+				Description: kmlCDATA{coverageBalloon(row)},
+				StyleURL:    "#status-" + row.coverageStatus(),
+				Geometries:  kmlGeometries(geometry),
+			}
+			if row.RegionID == nil {
+				doc.Placemarks = append(doc.Placemarks, placemark)
+			} else {
+				byRegion[*row.RegionID] = append(byRegion[*row.RegionID], placemark)
+			}
+		}
+
+		children := make(map[int][]int)
+		var roots []int
+		names := make(map[int]string, len(regions))
+		for _, r := range regions {
+			names[r.ID] = r.Name
+			if r.ParentID == nil {
+				roots = append(roots, r.ID)
+			} else {
+				children[*r.ParentID] = append(children[*r.ParentID], r.ID)
+			}
+		}
+
+		// Build folders depth first, leaving out regions with no locations.
+		var build func(id int) (kmlExportFolder, bool)
+		build = func(id int) (kmlExportFolder, bool) {
+			folder := kmlExportFolder{Name: names[id], Placemarks: byRegion[id]}
+			for _, child := range children[id] {
+				if sub, ok := build(child); ok {
+					folder.Folders = append(folder.Folders, sub)
+				}
+			}
+			return folder, len(folder.Placemarks) > 0 || len(folder.Folders) > 0
+		}
+		for _, id := range roots {
+			if folder, ok := build(id); ok {
+				doc.Folders = append(doc.Folders, folder)
+			}
+		}
+
+		body, err := xml.MarshalIndent(kmlExport{Document: doc}, "", "  ")
+		if err != nil {
+			log.Printf("Error encoding territories export: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export territories"})
+			return
+		}
+
+		c.Header("Content-Disposition", `attachment; filename="territories.kml"`)
+		c.Data(http.StatusOK, "application/vnd.google-earth.kml+xml", append([]byte(xml.Header), body...))
+	}
+}
+
+// coverageBalloon builds the HTML shown when a placemark is clicked in
+// Google Earth.
+func coverageBalloon(row locationExportRow) string {
+	var b strings.Builder
+	line := func(label, value string) {
+		fmt.Fprintf(&b, "<b>%s:</b> %s<br>", label, html.EscapeString(value))
+	}
+
+	line("Status", row.coverageStatus())
+	if row.Address != "" {
+		line("Address", row.Address)
+	}
+	lastVisit := "never"
+	if len(row.LastVisit) >= len("2006-01-02") {
+		lastVisit = row.LastVisit[:len("2006-01-02")]
+	}
+	line("Last visit", lastVisit)
+	if row.LastVisitTeam != nil {
+		line("Visited by", *row.LastVisitTeam)
+	}
+	if row.AssignedTeamName != nil {
+		line("Assigned to", *row.AssignedTeamName)
+	}
+	line("Visits", strconv.Itoa(row.VisitCount))
+	return b.String()
+}
+
+// kmlGeometries converts a stored geometry back into KML elements. Multi
+// geometries and collections become a MultiGeometry.
+func kmlGeometries(g geo.Geometry) Geometries {
+	var out Geometries
+	switch g.Type {
+	case geo.TypePoint:
+		out.Points = append(out.Points, Point{Coordinates: kmlCoordinates([]geo.Position{g.Point})})
+	case geo.TypeLineString:
+		out.LineStrings = append(out.LineStrings, LineString{Coordinates: kmlCoordinates(g.LineString)})
+	case geo.TypePolygon:
+		out.Polygons = append(out.Polygons, kmlPolygon(g.Polygon))
+	case geo.TypeMultiPoint, geo.TypeMultiLineString, geo.TypeMultiPolygon, geo.TypeGeometryCollection:
+		var multi MultiGeometry
+		for _, p := range g.MultiPoint {
+			multi.Points = append(multi.Points, Point{Coordinates: kmlCoordinates([]geo.Position{p})})
+		}
+		for _, line := range g.MultiLineString {
+			multi.LineStrings = append(multi.LineStrings, LineString{Coordinates: kmlCoordinates(line)})
+		}
+		for _, p := range g.MultiPolygon {
+			multi.Polygons = append(multi.Polygons, kmlPolygon(p))
+		}
+		for _, part := range g.Geometries {
+			inner := kmlGeometries(part)
+			multi.Points = append(multi.Points, inner.Points...)
+			multi.LineStrings = append(multi.LineStrings, inner.LineStrings...)
+			multi.Polygons = append(multi.Polygons, inner.Polygons...)
+			multi.MultiGeometries = append(multi.MultiGeometries, inner.MultiGeometries...)
+		}
+		out.MultiGeometries = append(out.MultiGeometries, multi)
+	}
+	return out
+}
+
+func kmlPolygon(p geo.Polygon) Polygon {
+	var polygon Polygon
+	for i, ring := range p {
+		var boundary Boundary
+		boundary.LinearRing.Coordinates = kmlCoordinates(ring)
+		if i == 0 {
+			polygon.OuterBoundaryIs = boundary
+		} else {
+			polygon.InnerBoundaryIs = append(polygon.InnerBoundaryIs, boundary)
+		}
+	}
+	return polygon
+}
+
+func kmlCoordinates(positions []geo.Position) string {
+	tuples := make([]string, len(positions))
+	for i, pos := range positions {
+		tuples[i] = strconv.FormatFloat(pos.Lon(), 'f', -1, 64) + "," + strconv.FormatFloat(pos.Lat(), 'f', -1, 64)
+	}
+	return strings.Join(tuples, " ")
+}
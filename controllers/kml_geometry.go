@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"team-tracker-backend/geo"
+)
+
+// Geometries holds the KML geometry elements that can appear in a Placemark
+// or a MultiGeometry. The gx:Track extension elements are matched by local
+// name so files that omit the gx namespace declaration still parse.
+type Geometries struct {
+	Points          []Point         `xml:"Point"`
+	LineStrings     []LineString    `xml:"LineString"`
+	LinearRings     []LineString    `xml:"LinearRing"`
+	Polygons        []Polygon       `xml:"Polygon"`
+	MultiGeometries []MultiGeometry `xml:"MultiGeometry"`
+	Tracks          []Track         `xml:"Track"`
+	MultiTracks     []MultiTrack    `xml:"MultiTrack"`
+	Models          []kmlElement    `xml:"Model"`
+}
+
+type Point struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type LineString struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type Polygon struct {
+	OuterBoundaryIs Boundary   `xml:"outerBoundaryIs"`
+	InnerBoundaryIs []Boundary `xml:"innerBoundaryIs"`
+}
+
+type Boundary struct {
+	LinearRing struct {
+		Coordinates string `xml:"coordinates"`
+	} `xml:"LinearRing"`
+}
+
+type MultiGeometry struct {
+	Geometries
+	Other []kmlElement `xml:",any"`
+}
+
+// Track is a gx:Track; each gx:coord is a space-separated "lon lat alt".
+type Track struct {
+	Coords []string `xml:"coord"`
+}
+
+type MultiTrack struct {
+	Tracks []Track `xml:"Track"`
+}
+
+// kmlElement captures the name of an element the parser doesn't model.
+type kmlElement struct {
+	XMLName xml.Name
+}
+
+// placemarkChildren are the non-geometry Placemark children defined by KML
+// 2.2 and the Google extensions. Anything else is reported as unsupported.
+var placemarkChildren = map[string]bool{
+	"name": true, "description": true, "visibility": true, "open": true,
+	"address": true, "AddressDetails": true, "phoneNumber": true,
+	"Snippet": true, "snippet": true, "styleUrl": true, "Style": true,
+	"StyleMap": true, "TimeStamp": true, "TimeSpan": true, "LookAt": true,
+	"Camera": true, "Region": true, "Metadata": true, "ExtendedData": true,
+	"author": true, "link": true, "balloonVisibility": true,
+}
+
+// unsupportedFeatures are the KML features other than Placemark and Folder
+// that can appear in a document or folder.
+var unsupportedFeatures = map[string]bool{
+	"NetworkLink": true, "GroundOverlay": true, "PhotoOverlay": true,
+	"ScreenOverlay": true, "Tour": true,
+}
+
+// collect appends the geometries to parts. Elements that cannot be
+// represented are described in unsupported; malformed coordinates are an
+// error because the placemark's shape would be wrong.
+func (g Geometries) collect(parts *[]geo.Geometry, unsupported *[]string) error {
+	for _, p := range g.Points {
+		coords := extractCoordinates(p.Coordinates)
+		if coords == nil {
+			return fmt.Errorf("invalid point coordinates %q", strings.TrimSpace(p.Coordinates))
+		}
+		*parts = append(*parts, geo.NewPoint(coords[0], coords[1]))
+	}
+
+	for _, l := range g.LineStrings {
+		line, err := parseLine(l.Coordinates)
+		if err != nil {
+			return fmt.Errorf("invalid line string: %v", err)
+		}
+		*parts = append(*parts, geo.NewLineString(line))
+	}
+
+	for _, l := range g.LinearRings {
+		ring, err := parseRing(l.Coordinates)
+		if err != nil {
+			return fmt.Errorf("invalid linear ring: %v", err)
+		}
+		*parts = append(*parts, geo.NewLineString(ring))
+	}
+
+	for i := range g.Polygons {
+		polygon, err := parsePolygon(&g.Polygons[i])
+		if err != nil {
+			return fmt.Errorf("invalid polygon: %v", err)
+		}
+		*parts = append(*parts, geo.NewPolygon(polygon))
+	}
+
+	for _, m := range g.MultiGeometries {
+		if err := m.Geometries.collect(parts, unsupported); err != nil {
+			return err
+		}
+		for _, other := range m.Other {
+			*unsupported = append(*unsupported, other.XMLName.Local)
+		}
+	}
+
+	tracks := g.Tracks
+	for _, mt := range g.MultiTracks {
+		tracks = append(tracks, mt.Tracks...)
+	}
+	for _, t := range tracks {
+		line, err := parseTrack(t)
+		if err != nil {
+			return fmt.Errorf("invalid track: %v", err)
+		}
+		*parts = append(*parts, geo.NewLineString(line))
+	}
+
+	for range g.Models {
+		*unsupported = append(*unsupported, "Model")
+	}
+
+	return nil
+}
+
+func parsePolygon(p *Polygon) (geo.Polygon, error) {
+	outer, err := parseRing(p.OuterBoundaryIs.LinearRing.Coordinates)
+	if err != nil {
+		return nil, fmt.Errorf("outer boundary: %v", err)
+	}
+
+	polygon := geo.Polygon{outer}
+	for i, inner := range p.InnerBoundaryIs {
+		ring, err := parseRing(inner.LinearRing.Coordinates)
+		if err != nil {
+			return nil, fmt.Errorf("inner boundary %d: %v", i+1, err)
+		}
+		polygon = append(polygon, ring)
+	}
+	return polygon, nil
+}
+
+// parseRing reads a KML coordinate list into a closed ring. Tuples are
+// separated by any whitespace and may carry a third altitude value.
+func parseRing(coordStr string) (geo.Ring, error) {
+	positions, err := parsePositions(coordStr)
+	if err != nil {
+		return nil, err
+	}
+
+	ring := geo.Ring(positions)
+	if len(ring) < 3 {
+		return nil, fmt.Errorf("ring has %d positions, need at least 3", len(ring))
+	}
+	if ring[0] != ring[len(ring)-1] {
+		ring = append(ring, ring[0])
+	}
+	return ring, nil
+}
+
+func parseLine(coordStr string) ([]geo.Position, error) {
+	line, err := parsePositions(coordStr)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 {
+		return nil, fmt.Errorf("line has %d positions, need at least 2", len(line))
+	}
+	return line, nil
+}
+
+func parsePositions(coordStr string) ([]geo.Position, error) {
+	var positions []geo.Position
+	for _, tuple := range strings.Fields(coordStr) {
+		coords := extractCoordinates(tuple)
+		if coords == nil {
+			return nil, fmt.Errorf("invalid coordinate %q", tuple)
+		}
+		positions = append(positions, geo.Position{coords[0], coords[1]})
+	}
+	return positions, nil
+}
+
+func parseTrack(t Track) ([]geo.Position, error) {
+	var line []geo.Position
+	for _, coord := range t.Coords {
+		fields := strings.Fields(coord)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid coordinate %q", coord)
+		}
+		lon, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid longitude %q", fields[0])
+		}
+		lat, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latitude %q", fields[1])
+		}
+		line = append(line, geo.Position{lon, lat})
+	}
+	if len(line) < 2 {
+		return nil, fmt.Errorf("track has %d positions, need at least 2", len(line))
+	}
+	return line, nil
+}
@@ -0,0 +1,635 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"team-tracker-backend/geo"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Lineage operations.
+const (
+	LineageSplit = "split"
+	LineageMerge = "merge"
+)
+
+const (
+	maxSplitParts = 20
+	// mergeAdjacency is how far apart two territories can be drawn and still
+	// count as neighbours for a merge.
+	mergeAdjacency = 50 // metres
+)
+
+// LineageLocationIDs selects the id of location l and of every location it
+// was split or merged from. A split leaves the visits on the location that
+// was split, so these are the locations whose visits count for l.
+const LineageLocationIDs = `WITH RECURSIVE lineage(id) AS (
+                SELECT l.id
+                UNION
+                SELECT ll.parent_id FROM location_lineage ll JOIN lineage ON ll.child_id = lineage.id)
+            SELECT id FROM lineage`
+
+// locationAncestors returns the locations a location was split or merged
+// from, directly or through earlier splits and merges.
+func locationAncestors(q sqlx.Queryer, id int) ([]int, error) {
+	ancestors := []int{}
+	err := sqlx.Select(q, &ancestors, `
+        WITH RECURSIVE ancestors(id) AS (
+            SELECT parent_id FROM location_lineage WHERE child_id = ?
+            UNION
+            SELECT ll.parent_id FROM location_lineage ll JOIN ancestors a ON ll.child_id = a.id
+        )
+        SELECT id FROM ancestors ORDER BY id`, id)
+	return ancestors, err
+}
+
+// lineageLocation is a location being split or merged.
+type lineageLocation struct {
+	ID           int     `db:"id"`
+	Name         string  `db:"name"`
+	Latitude     float64 `db:"latitude"`
+	Longitude    float64 `db:"longitude"`
+	Geometry     *string `db:"geometry"`
+	Description  string  `db:"description"`
+	Address      string  `db:"address"`
+	Notes        string  `db:"notes"`
+	LocationType string  `db:"location_type"`
+	RegionID     *int    `db:"region_id"`
+	IsPreached   bool    `db:"is_preached"`
+	DoorCount    *int    `db:"door_count"`
+}
+
+// derivedLocation is a location created by a split or merge.
+type derivedLocation struct {
+	Name         string
+	Geometry     geo.Geometry
+	Description  string
+	Address      string
+	Notes        string
+	LocationType string
+	RegionID     *int
+	IsPreached   bool
+	DoorCount    *int
+}
+
+// loadLineageLocation loads an active location with its geometry. It writes
+// an error response and returns false if there is no such location.
+func loadLineageLocation(c *gin.Context, tx *sqlx.Tx, id int) (lineageLocation, geo.Geometry, bool) {
+	var loc lineageLocation
+	err := tx.Get(&loc, `
+        SELECT id, name, latitude, longitude, geometry, description, address, notes,
+               location_type, region_id, COALESCE(is_preached, FALSE) as is_preached, door_count
+        FROM locations WHERE id = ? AND is_retired = FALSE`, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Location %d not found", id)})
+		return loc, geo.Geometry{}, false
+	}
+	if err != nil {
+		log.Printf("Error fetching location %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch location"})
+		return loc, geo.Geometry{}, false
+	}
+
+	geometry, err := decodeGeometry(loc.Geometry, loc.Latitude, loc.Longitude)
+	if err != nil {
+		log.Printf("Invalid geometry stored for location %d: %v", loc.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read location geometry"})
+		return loc, geo.Geometry{}, false
+	}
+	return loc, geometry, true
+}
+
+// insertDerivedLocation adds a location made by a split or merge. It has no
+// source, so imports leave it alone.
+func insertDerivedLocation(tx *sqlx.Tx, loc derivedLocation) (int, error) {
+	geometry, err := json.Marshal(loc.Geometry)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode geometry for %s: %v", loc.Name, err)
+	}
+	center := loc.Geometry.Centroid()
+	result, err := tx.Exec(`
+        INSERT INTO locations
+        (name, latitude, longitude, geometry, area_m2, perimeter_m, description, address,
+         notes, location_type, region_id, is_preached, door_count)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		loc.Name, center.Lat(), center.Lon(), string(geometry), loc.Geometry.Area(), loc.Geometry.Perimeter(),
+		loc.Description, loc.Address, loc.Notes, loc.LocationType, loc.RegionID, loc.IsPreached, loc.DoorCount)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert location %s: %v", loc.Name, err)
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// retireReplaced retires the parents of a split or merge and records the
+// lineage from each of them to each child.
+func retireReplaced(tx *sqlx.Tx, operation string, parents, children []int) error {
+	for _, parent := range parents {
+		_, err := tx.Exec(`
+            UPDATE locations SET is_retired = TRUE, retired_at = CURRENT_TIMESTAMP
+            WHERE id = ?`, parent)
+		if err != nil {
+			return fmt.Errorf("failed to retire location %d: %v", parent, err)
+		}
+		for _, child := range children {
+			_, err := tx.Exec(`
+                INSERT INTO location_lineage (parent_id, child_id, operation)
+                VALUES (?, ?, ?)`, parent, child, operation)
+			if err != nil {
+				return fmt.Errorf("failed to record lineage of location %d: %v", parent, err)
+			}
+		}
+	}
+	return nil
+}
+
+type SplitRequest struct {
+	// Line is a line drawn across the territory, as [lon, lat] positions.
+	Line []geo.Position `json:"line"`
+	// Parts splits the territory into that many parts of about equal area.
+	Parts int `json:"parts"`
+	// Names of the new locations; by default the original name numbered.
+	Names []string `json:"names"`
+}
+
+// SplitLocation splits a polygon territory in two along a drawn line, or into
+// a number of parts of about equal area. The original is retired and each
+// part inherits its details, visit history, assignments, planned visits and
+// media; the door count is shared out by area.
+func SplitLocation(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var id int
+		if _, err := fmt.Sscan(c.Param("id"), &id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location id"})
+			return
+		}
+		var request SplitRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		if (len(request.Line) > 0) == (request.Parts > 0) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Give either a line or a number of parts"})
+			return
+		}
+		if request.Parts == 1 || request.Parts > maxSplitParts {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("parts must be between 2 and %d", maxSplitParts)})
+			return
+		}
+
+		tx, err := db.Beginx()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+			return
+		}
+		defer tx.Rollback()
+
+		parent, geometry, ok := loadLineageLocation(c, tx, id)
+		if !ok {
+			return
+		}
+		if geometry.Type != geo.TypePolygon {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only a single polygon can be split"})
+			return
+		}
+
+		var parts []geo.Polygon
+		if len(request.Line) > 0 {
+			if err := geo.NewLineString(request.Line).Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid line: " + err.Error()})
+				return
+			}
+			one, two, err := geo.SplitPolygon(geometry.Polygon, request.Line)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot split along this line: " + err.Error()})
+				return
+			}
+			parts = []geo.Polygon{one, two}
+		} else {
+			for _, part := range geo.DividePolygon(geometry.Polygon, request.Parts) {
+				if len(part) > 0 {
+					parts = append(parts, part)
+				}
+			}
+		}
+		if len(parts) < 2 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Territory is too small to split"})
+			return
+		}
+		if len(request.Names) > 0 && len(request.Names) != len(parts) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Give %d names, one for each part", len(parts))})
+			return
+		}
+
+		total := geometry.Area()
+		var children []int
+		for i, part := range parts {
+			shape := geo.NewPolygon(part)
+			name := fmt.Sprintf("%s (%d/%d)", strings.TrimSpace(parent.Name), i+1, len(parts))
+			if len(request.Names) > 0 && strings.TrimSpace(request.Names[i]) != "" {
+				name = request.Names[i]
+			}
+			var doors *int
+			if parent.DoorCount != nil && total > 0 {
+				share := int(math.Round(float64(*parent.DoorCount) * shape.Area() / total))
+				doors = &share
+			}
+
+			child, err := insertDerivedLocation(tx, derivedLocation{
+				Name:         name,
+				Geometry:     shape,
+				Description:  parent.Description,
+				Address:      parent.Address,
+				Notes:        parent.Notes,
+				LocationType: parent.LocationType,
+				RegionID:     parent.RegionID,
+				IsPreached:   parent.IsPreached,
+				DoorCount:    doors,
+			})
+			if err == nil {
+				err = copyLocationRecords(tx, parent.ID, child)
+			}
+			if err != nil {
+				log.Printf("Error splitting location %d: %v", parent.ID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to split location"})
+				return
+			}
+			children = append(children, child)
+		}
+
+		if err := finishReplacement(tx, LineageSplit, []int{parent.ID}, children); err != nil {
+			log.Printf("Error splitting location %d: %v", parent.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to split location"})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		log.Printf("Split location %d into %v", parent.ID, children)
+		respondWithLocations(c, db, http.StatusCreated, children)
+	}
+}
+
+// copyLocationRecords gives a part of a split location its own copy of the
+// original's assignments, planned visits and media. The visits stay on the
+// original, where each is counted once; the parts read them through
+// LineageLocationIDs.
+func copyLocationRecords(tx *sqlx.Tx, parent, child int) error {
+	statements := []string{`
+        INSERT INTO team_assignments (team_id, location_id, status, is_completed, assigned_date,
+                                      due_date, completed_date, returned_date)
+        SELECT team_id, ?, status, is_completed, assigned_date, due_date, completed_date, returned_date
+        FROM team_assignments WHERE location_id = ? ORDER BY id`, `
+        INSERT INTO planned_visits (location_id, team_id, planned_date, created_at, status)
+        SELECT ?, team_id, planned_date, created_at, status
+        FROM planned_visits WHERE location_id = ? ORDER BY id`, `
+        INSERT INTO location_media (location_id, url, position)
+        SELECT ?, url, position
+        FROM location_media WHERE location_id = ? ORDER BY position`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, child, parent); err != nil {
+			return err
+		}
+	}
+	return recordInheritedAssignments(tx, child, fmt.Sprintf("split from location %d", parent))
+}
+
+// recordInheritedAssignments starts the audit trail of the assignments a
+// split or merge gave to a new location.
+func recordInheritedAssignments(tx *sqlx.Tx, location int, note string) error {
+	_, err := tx.Exec(`
+        INSERT INTO assignment_events (assignment_id, team_id, location_id, from_status, to_status,
+                                       action, note, team_name, location_name)
+        SELECT ta.id, ta.team_id, ta.location_id, NULL, ta.status, ?, ?,
+               `+eventSnapshot+`
+        FROM team_assignments ta WHERE ta.location_id = ? ORDER BY ta.id`, ActionInherited, note, location)
+	return err
+}
+
+// finishReplacement clears the assignments and planned visits of replaced
+// locations, which their replacements have taken over, retires them and
+// records the lineage.
+func finishReplacement(tx *sqlx.Tx, operation string, parents, children []int) error {
+	closing, args, err := sqlx.In(`
+        INSERT INTO assignment_events (assignment_id, team_id, location_id, from_status, to_status,
+                                       action, note, team_name, location_name)
+        SELECT ta.id, ta.team_id, ta.location_id, ta.status, 'reassigned', ?, ?,
+               `+eventSnapshot+`
+        FROM team_assignments ta WHERE ta.location_id IN (?) AND `+openAssignment+`
+        ORDER BY ta.id`, ActionReplaced, "location "+operation, parents)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(closing, args...); err != nil {
+		return err
+	}
+
+	query, args, err := sqlx.In(`DELETE FROM team_assignments WHERE location_id IN (?)`, parents)
+	if err != nil {
+		return err
+	}
+	statements := []string{
+		query,
+		strings.Replace(query, "team_assignments", "planned_visits", 1),
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, args...); err != nil {
+			return err
+		}
+	}
+	return retireReplaced(tx, operation, parents, children)
+}
+
+type MergeRequest struct {
+	LocationIDs []int `json:"location_ids" binding:"required"`
+	// Name of the merged location; by default the first location's name.
+	Name string `json:"name"`
+}
+
+// MergeLocations merges neighbouring territories into one location whose
+// geometry holds all of theirs. Each must be within mergeAdjacency metres of
+// another in the group. The merged location takes over their assignments
+// (open if any of them was), planned visits and media. Their visits stay on
+// them and count for the merged location through LineageLocationIDs, which
+// also decides whether it is preached. Locations checked out to different
+// teams can't be merged.
+func MergeLocations(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request MergeRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		seen := make(map[int]bool)
+		for _, id := range request.LocationIDs {
+			if seen[id] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Location %d is listed twice", id)})
+				return
+			}
+			seen[id] = true
+		}
+		if len(request.LocationIDs) < 2 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Give at least two locations to merge"})
+			return
+		}
+
+		tx, err := db.Beginx()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+			return
+		}
+		defer tx.Rollback()
+
+		parents := make([]lineageLocation, len(request.LocationIDs))
+		shapes := make([]geo.Geometry, len(request.LocationIDs))
+		for i, id := range request.LocationIDs {
+			var ok bool
+			if parents[i], shapes[i], ok = loadLineageLocation(c, tx, id); !ok {
+				return
+			}
+		}
+		if apart := unconnectedLocation(shapes); apart >= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(
+				"Location %d is not next to the others; territories must be within %d m of each other to merge",
+				parents[apart].ID, mergeAdjacency)})
+			return
+		}
+		holders, err := openHolders(tx, request.LocationIDs, 0)
+		if err != nil {
+			log.Printf("Error checking assignments of locations %v: %v", request.LocationIDs, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge locations"})
+			return
+		}
+		for _, holder := range holders {
+			if holder.TeamID != holders[0].TeamID {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":     "The locations are checked out to different teams; transfer them to one team first",
+					"conflicts": holders,
+				})
+				return
+			}
+		}
+
+		merged := derivedLocation{
+			Name:         parents[0].Name,
+			Geometry:     mergedGeometry(shapes),
+			LocationType: parents[0].LocationType,
+			RegionID:     parents[0].RegionID,
+		}
+		if strings.TrimSpace(request.Name) != "" {
+			merged.Name = request.Name
+		}
+		var descriptions, addresses, notes []string
+		for _, parent := range parents {
+			descriptions = appendDistinct(descriptions, parent.Description)
+			addresses = appendDistinct(addresses, parent.Address)
+			notes = appendDistinct(notes, parent.Notes)
+			if parent.DoorCount != nil {
+				doors := *parent.DoorCount
+				if merged.DoorCount != nil {
+					doors += *merged.DoorCount
+				}
+				merged.DoorCount = &doors
+			}
+		}
+		merged.Description = strings.Join(descriptions, "\n\n")
+		merged.Address = strings.Join(addresses, "\n")
+		merged.Notes = strings.Join(notes, "\n")
+
+		ids := request.LocationIDs
+		child, err := insertDerivedLocation(tx, merged)
+		if err == nil {
+			err = moveLocationRecords(tx, ids, child)
+		}
+		if err == nil {
+			err = finishReplacement(tx, LineageMerge, ids, []int{child})
+		}
+		if err == nil {
+			err = refreshLocationPreached(tx, child)
+		}
+		if err != nil {
+			log.Printf("Error merging locations %v: %v", ids, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge locations"})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		log.Printf("Merged locations %v into %d", ids, child)
+		respondWithLocations(c, db, http.StatusCreated, []int{child})
+	}
+}
+
+// unconnectedLocation returns the index of a geometry that can't be reached
+// from the first through neighbouring ones, or -1 if they are all
+// connected.
+func unconnectedLocation(shapes []geo.Geometry) int {
+	reached := make([]bool, len(shapes))
+	reached[0] = true
+	queue := []int{0}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for j := range shapes {
+			if !reached[j] && geo.Gap(shapes[i], shapes[j]) <= mergeAdjacency {
+				reached[j] = true
+				queue = append(queue, j)
+			}
+		}
+	}
+	for i, ok := range reached {
+		if !ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// mergedGeometry collects the parts into one geometry, flattening polygons
+// and multipolygons into a single MultiPolygon when there is nothing else.
+func mergedGeometry(shapes []geo.Geometry) geo.Geometry {
+	var polygons []geo.Geometry
+	for _, shape := range shapes {
+		if len(shape.Points()) > 0 || len(shape.Lines()) > 0 {
+			return geo.Collect(shapes)
+		}
+		for _, p := range shape.Polygons() {
+			polygons = append(polygons, geo.NewPolygon(p))
+		}
+	}
+	return geo.Collect(polygons)
+}
+
+// moveLocationRecords hands the assignments, planned visits and media of
+// merged locations to the location that replaces them. A team
+// assigned several of them gets one assignment, open if any was; planned
+// visits on the same day collapse into one, preferring ones not cancelled.
+// The merged assignment takes the most active status, and the earliest due
+// date of the open ones.
+func moveLocationRecords(tx *sqlx.Tx, parents []int, child int) error {
+	statements := []string{`
+        INSERT INTO team_assignments (team_id, location_id, status, is_completed, assigned_date,
+                                      due_date, completed_date, returned_date)
+        SELECT team_id, ?,
+               CASE WHEN MAX(status = 'in_progress') THEN 'in_progress'
+                    WHEN MAX(status = 'checked_out') THEN 'checked_out'
+                    WHEN MIN(status = 'completed') THEN 'completed'
+                    WHEN MAX(status = 'returned') THEN 'returned'
+                    ELSE 'reassigned' END,
+               MIN(status = 'completed'), MIN(assigned_date),
+               MIN(CASE WHEN status IN ('checked_out', 'in_progress') THEN due_date END),
+               CASE WHEN MIN(status = 'completed') THEN MAX(completed_date) END,
+               CASE WHEN MAX(status IN ('checked_out', 'in_progress')) = 0
+                     AND MIN(status = 'completed') = 0 THEN MAX(returned_date) END
+        FROM team_assignments WHERE location_id IN (?)
+        GROUP BY team_id ORDER BY MIN(id)`, `
+        INSERT OR IGNORE INTO planned_visits (location_id, team_id, planned_date, created_at, status)
+        SELECT ?, team_id, planned_date, created_at, status
+        FROM planned_visits WHERE location_id IN (?)
+        ORDER BY COALESCE(status, 'planned') = 'cancelled', id`, `
+        INSERT OR IGNORE INTO location_media (location_id, url, position)
+        SELECT ?, url, ROW_NUMBER() OVER (ORDER BY location_id, position) - 1
+        FROM location_media WHERE location_id IN (?)`,
+	}
+	for _, statement := range statements {
+		query, args, err := sqlx.In(statement, child, parents)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return recordInheritedAssignments(tx, child, fmt.Sprintf("merged from locations %v", parents))
+}
+
+func appendDistinct(values []string, value string) []string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return values
+	}
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// respondWithLocations replies with the locations created by a split or
+// merge.
+func respondWithLocations(c *gin.Context, db *sqlx.DB, status int, ids []int) {
+	query, args, err := sqlx.In("SELECT "+locationColumns+" FROM locations WHERE id IN (?) ORDER BY id", ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+		return
+	}
+	locations := []Location{}
+	if err := db.Select(&locations, query, args...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+		return
+	}
+	c.JSON(status, locations)
+}
+
+// LineageEntry is a location that a location was split or merged from, or
+// into.
+type LineageEntry struct {
+	LocationID int    `json:"location_id" db:"location_id"`
+	Name       string `json:"name" db:"name"`
+	IsRetired  bool   `json:"is_retired" db:"is_retired"`
+	Operation  string `json:"operation" db:"operation"`
+	CreatedAt  string `json:"created_at" db:"created_at"`
+}
+
+type LocationLineage struct {
+	// Parents are the locations this one was split or merged from.
+	Parents []LineageEntry `json:"parents"`
+	// Children are the locations this one was split or merged into.
+	Children []LineageEntry `json:"children"`
+}
+
+// GetLocationLineage lists the locations a location was made from and the
+// ones that replaced it.
+func GetLocationLineage(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var exists int
+		if err := db.Get(&exists, "SELECT COUNT(*) FROM locations WHERE id = ?", id); err != nil || exists == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+			return
+		}
+
+		lineage := LocationLineage{Parents: []LineageEntry{}, Children: []LineageEntry{}}
+		const query = `
+            SELECT l.id as location_id, l.name, l.is_retired, ll.operation, ll.created_at
+            FROM location_lineage ll
+            JOIN locations l ON l.id = ll.%s
+            WHERE ll.%s = ?
+            ORDER BY ll.id`
+		if err := db.Select(&lineage.Parents, fmt.Sprintf(query, "parent_id", "child_id"), id); err != nil {
+			log.Printf("Error fetching lineage of location %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lineage"})
+			return
+		}
+		if err := db.Select(&lineage.Children, fmt.Sprintf(query, "child_id", "parent_id"), id); err != nil {
+			log.Printf("Error fetching lineage of location %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lineage"})
+			return
+		}
+
+		c.JSON(http.StatusOK, lineage)
+	}
+}
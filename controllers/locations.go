@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"team-tracker-backend/geo"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+type Location struct {
+	ID           int     `json:"id" db:"id"`
+	Name         string  `json:"name" db:"name"`
+	Latitude     float64 `json:"latitude" db:"latitude"`
+	Longitude    float64 `json:"longitude" db:"longitude"`
+	RegionID     *int    `json:"region_id" db:"region_id"`
+	Address      string  `json:"address" db:"address"`
+	Notes        string  `json:"notes" db:"notes"`
+	LocationType string  `json:"location_type" db:"location_type"`
+	// AreaM2 and PerimeterM are computed from the geometry; both are 0 for
+	// a point.
+	AreaM2     float64 `json:"area_m2" db:"area_m2"`
+	PerimeterM float64 `json:"perimeter_m" db:"perimeter_m"`
+	// DoorCount is the estimated number of households, if anyone has
+	// entered one.
+	DoorCount *int `json:"door_count" db:"door_count"`
+}
+
+// LocationDetail is a single location with its raw description and media.
+type LocationDetail struct {
+	Location
+	Description string   `json:"description" db:"description"`
+	IsPreached  bool     `json:"is_preached" db:"is_preached"`
+	IsRetired   bool     `json:"is_retired" db:"is_retired"`
+	MediaURLs   []string `json:"media_urls" db:"-"`
+}
+
+const locationColumns = `id, name, latitude, longitude, region_id, address, notes, location_type,
+    COALESCE(area_m2, 0) as area_m2, COALESCE(perimeter_m, 0) as perimeter_m, door_count`
+
+// locationFilter narrows the active locations returned by selectLocations.
+// Empty fields are ignored.
+type locationFilter struct {
+	RegionID          string
+	RegionName        string
+	IncludeSubregions bool
+	LocationType      string
+	// BBox is minLon, minLat, maxLon, maxLat; locations whose geometry
+	// intersects it are returned.
+	BBox *[4]float64
+}
+
+// locationsInBox selects, from the spatial index, the ids of locations whose
+// bounding box intersects a box. Its arguments are minLon, maxLon, minLat,
+// maxLat.
+const locationsInBox = `
+    SELECT id FROM location_rtree
+    WHERE max_lon >= ? AND min_lon <= ? AND max_lat >= ? AND min_lat <= ?`
+
+func selectLocations(db *sqlx.DB, filter locationFilter) ([]Location, error) {
+	query := "SELECT " + locationColumns + " FROM locations WHERE is_retired = FALSE"
+	var args []interface{}
+
+	if filter.LocationType != "" {
+		query += " AND location_type = ?"
+		args = append(args, filter.LocationType)
+	}
+
+	if box := filter.BBox; box != nil {
+		query += " AND id IN (" + locationsInBox + ")"
+		args = append(args, box[0], box[2], box[1], box[3])
+	}
+
+	if filter.RegionID != "" || filter.RegionName != "" {
+		seed, arg := "id = ?", interface{}(filter.RegionID)
+		if filter.RegionID == "" {
+			seed, arg = "name = ? COLLATE NOCASE", filter.RegionName
+		}
+
+		if filter.IncludeSubregions {
+			query += " AND region_id IN (" + fmt.Sprintf(regionSubtree, seed) + ")"
+		} else {
+			query += " AND region_id IN (SELECT id FROM regions WHERE " + seed + ")"
+		}
+		args = append(args, arg)
+	}
+
+	query += " ORDER BY id"
+
+	locations := []Location{}
+	if err := db.Select(&locations, query, args...); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+// GetLocations lists active locations. region_id or region (a region name)
+// restrict the result to that region and, unless include_subregions=false,
+// its subregions; type restricts it to one location type; and
+// bbox=minLon,minLat,maxLon,maxLat to locations that overlap the box.
+func GetLocations(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := locationFilter{
+			RegionID:          c.Query("region_id"),
+			RegionName:        c.Query("region"),
+			IncludeSubregions: c.DefaultQuery("include_subregions", "true") != "false",
+			LocationType:      c.Query("type"),
+		}
+		if value := c.Query("bbox"); value != "" {
+			box, err := parseBBox(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter.BBox = box
+		}
+
+		locations, err := selectLocations(db, filter)
+		if err != nil {
+			log.Printf("Error fetching locations: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+			return
+		}
+
+		c.JSON(http.StatusOK, locations)
+	}
+}
+
+// GetLocation returns one location, including retired ones, with its
+// description and media links.
+func GetLocation(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var location LocationDetail
+
+		err := db.Get(&location, `
+            SELECT `+locationColumns+`, description, is_preached, is_retired
+            FROM locations WHERE id = ?`, id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching location %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch location"})
+			return
+		}
+
+		location.MediaURLs = []string{}
+		err = db.Select(&location.MediaURLs,
+			"SELECT url FROM location_media WHERE location_id = ? ORDER BY position", location.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch location media"})
+			return
+		}
+
+		c.JSON(http.StatusOK, location)
+	}
+}
+
+// UpdateLocation edits the fields of a location that aren't imported from
+// the territory files. Only door_count can be changed so far; null clears it.
+func UpdateLocation(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var request map[string]json.RawMessage
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		raw, ok := request["door_count"]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+			return
+		}
+		var doorCount *int
+		if err := json.Unmarshal(raw, &doorCount); err != nil || (doorCount != nil && *doorCount < 0) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "door_count must be a whole number of at least 0, or null"})
+			return
+		}
+
+		result, err := db.Exec("UPDATE locations SET door_count = ? WHERE id = ?", doorCount, id)
+		if err != nil {
+			log.Printf("Error updating location %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+			return
+		}
+
+		var location Location
+		if err := db.Get(&location, "SELECT "+locationColumns+" FROM locations WHERE id = ?", id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch location"})
+			return
+		}
+		c.JSON(http.StatusOK, location)
+	}
+}
+
+// RefreshLocationMetrics computes the area and perimeter of locations that
+// don't have them yet, such as ones imported before they were stored. It is
+// run at startup; imports keep them current after that.
+func RefreshLocationMetrics(db *sqlx.DB) error {
+	var rows []struct {
+		ID        int     `db:"id"`
+		Latitude  float64 `db:"latitude"`
+		Longitude float64 `db:"longitude"`
+		Geometry  *string `db:"geometry"`
+	}
+	err := db.Select(&rows, `
+        SELECT id, latitude, longitude, geometry FROM locations
+        WHERE area_m2 IS NULL OR perimeter_m IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to fetch locations: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, row := range rows {
+		geometry, err := decodeGeometry(row.Geometry, row.Latitude, row.Longitude)
+		if err != nil {
+			log.Printf("Invalid geometry stored for location %d: %v", row.ID, err)
+			geometry = geo.NewPoint(row.Longitude, row.Latitude)
+		}
+		_, err = tx.Exec("UPDATE locations SET area_m2 = ?, perimeter_m = ? WHERE id = ?",
+			geometry.Area(), geometry.Perimeter(), row.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update location %d: %v", row.ID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Computed area and perimeter of %d locations", len(rows))
+	return nil
+}
+
+// AvailableLocation is a location no team holds that still needs preaching.
+type AvailableLocation struct {
+	ID        int     `json:"id" db:"id"`
+	Name      string  `json:"name" db:"name"`
+	Latitude  float64 `json:"latitude" db:"latitude"`
+	Longitude float64 `json:"longitude" db:"longitude"`
+}
+
+// GetAvailableLocations lists the active, unpreached locations that aren't
+// checked out to a team.
+func GetAvailableLocations(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locations := []AvailableLocation{}
+		err := db.Select(&locations, `
+            SELECT id, name, latitude, longitude
+            FROM locations
+            WHERE is_preached = FALSE AND is_retired = FALSE
+            AND id NOT IN (SELECT location_id FROM team_assignments ta WHERE `+openAssignment+`)
+            ORDER BY name`)
+		if err != nil {
+			log.Printf("Error fetching available locations: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+			return
+		}
+
+		c.JSON(http.StatusOK, locations)
+	}
+}
+
+type LocationGeometry struct {
+	ID       int          `json:"id"`
+	Name     string       `json:"name"`
+	Centroid geo.Position `json:"centroid"`
+	Geometry geo.Geometry `json:"geometry"`
+}
+
+// GetLocationGeometry returns the stored boundary of a location. Locations
+// imported before geometry was kept fall back to their point.
+func GetLocationGeometry(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var row struct {
+			ID        int     `db:"id"`
+			Name      string  `db:"name"`
+			Latitude  float64 `db:"latitude"`
+			Longitude float64 `db:"longitude"`
+			Geometry  *string `db:"geometry"`
+		}
+
+		err := db.Get(&row, "SELECT id, name, latitude, longitude, geometry FROM locations WHERE id = ?", id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch location"})
+			return
+		}
+
+		geometry, err := decodeGeometry(row.Geometry, row.Latitude, row.Longitude)
+		if err != nil {
+			log.Printf("Invalid geometry stored for location %d: %v", row.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read location geometry"})
+			return
+		}
+
+		c.JSON(http.StatusOK, LocationGeometry{
+			ID:       row.ID,
+			Name:     row.Name,
+			Centroid: geo.Position{row.Longitude, row.Latitude},
+			Geometry: geometry,
+		})
+	}
+}
+
+// decodeGeometry parses a geometry column, falling back to the location's
+// point when no geometry has been stored yet.
+func decodeGeometry(stored *string, lat, lon float64) (geo.Geometry, error) {
+	if stored == nil || *stored == "" {
+		return geo.NewPoint(lon, lat), nil
+	}
+
+	var g geo.Geometry
+	if err := json.Unmarshal([]byte(*stored), &g); err != nil {
+		return geo.Geometry{}, err
+	}
+	return g, nil
+}
@@ -0,0 +1,358 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Roles a member can have on a team.
+const (
+	RoleLeader    = "leader"
+	RoleAssistant = "assistant"
+	RoleMember    = "member"
+)
+
+// teamRosterColumns selects the current leader of a team aliased t, and the
+// names of its other current members separated by "; ".
+const teamRosterColumns = `
+    (SELECT tm.member_id FROM team_memberships tm
+     WHERE tm.team_id = t.id AND tm.role = 'leader' AND tm.left_at IS NULL) as leader_id,
+    COALESCE((SELECT m.name FROM team_memberships tm JOIN members m ON m.id = tm.member_id
+              WHERE tm.team_id = t.id AND tm.role = 'leader' AND tm.left_at IS NULL), '') as leader,
+    COALESCE((SELECT group_concat(m.name, '; ') FROM team_memberships tm JOIN members m ON m.id = tm.member_id
+              WHERE tm.team_id = t.id AND tm.role != 'leader' AND tm.left_at IS NULL), '') as members`
+
+// rosterConflict is a membership change that would break a roster rule,
+// such as one person leading two teams.
+type rosterConflict struct {
+	message string
+}
+
+func (e *rosterConflict) Error() string { return e.message }
+
+// findOrCreateMember returns the member with a name, ignoring case,
+// preferring active members, and adds one if there is none.
+func findOrCreateMember(tx *sqlx.Tx, name string) (int, error) {
+	var id int
+	err := tx.Get(&id, `
+        SELECT id FROM members WHERE name = ? COLLATE NOCASE
+        ORDER BY is_active DESC, id LIMIT 1`, name)
+	if err != sql.ErrNoRows {
+		return id, err
+	}
+
+	result, err := tx.Exec("INSERT INTO members (name) VALUES (?)", name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add member %s: %v", name, err)
+	}
+	newID, err := result.LastInsertId()
+	return int(newID), err
+}
+
+// joinTeam gives a member a role on a team from a date. A member already on
+// the team with another role has that membership ended and a new one
+// started, so the roster history shows the change. A new leader replaces the
+// current one, who stays on as a member. It returns a rosterConflict if the
+// member already leads another team.
+func joinTeam(tx *sqlx.Tx, teamID, memberID int, role, joined string) error {
+	if role == RoleLeader {
+		var led string
+		err := tx.Get(&led, `
+            SELECT t.name FROM team_memberships tm JOIN teams t ON t.id = tm.team_id
+            WHERE tm.member_id = ? AND tm.role = 'leader' AND tm.left_at IS NULL AND tm.team_id != ?`,
+			memberID, teamID)
+		if err == nil {
+			var name string
+			if err := tx.Get(&name, "SELECT name FROM members WHERE id = ?", memberID); err != nil {
+				return err
+			}
+			return &rosterConflict{fmt.Sprintf("%s already leads %s", name, led)}
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		var current int
+		err = tx.Get(&current, `
+            SELECT member_id FROM team_memberships
+            WHERE team_id = ? AND role = 'leader' AND left_at IS NULL`, teamID)
+		if err == nil && current != memberID {
+			if err := joinTeam(tx, teamID, current, RoleMember, joined); err != nil {
+				return err
+			}
+		} else if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(`
+        UPDATE team_memberships SET left_at = ?
+        WHERE team_id = ? AND member_id = ? AND left_at IS NULL`, joined, teamID, memberID)
+	if err != nil {
+		return fmt.Errorf("failed to end membership: %v", err)
+	}
+	_, err = tx.Exec(`
+        INSERT INTO team_memberships (team_id, member_id, role, joined_at)
+        VALUES (?, ?, ?, ?)`, teamID, memberID, role, joined)
+	if err != nil {
+		return fmt.Errorf("failed to add membership: %v", err)
+	}
+	return nil
+}
+
+// setTeamLeader makes the named person lead a team, adding them as a member
+// if they are new. An empty name leaves the team without a leader; the
+// previous leader stays on as a member.
+func setTeamLeader(tx *sqlx.Tx, teamID int, name string) error {
+	today := time.Now().Format("2006-01-02")
+	if name = strings.TrimSpace(name); name == "" {
+		var current int
+		err := tx.Get(&current, `
+            SELECT member_id FROM team_memberships
+            WHERE team_id = ? AND role = 'leader' AND left_at IS NULL`, teamID)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return joinTeam(tx, teamID, current, RoleMember, today)
+	}
+
+	memberID, err := findOrCreateMember(tx, name)
+	if err != nil {
+		return err
+	}
+	var role string
+	err = tx.Get(&role, `
+        SELECT role FROM team_memberships
+        WHERE team_id = ? AND member_id = ? AND left_at IS NULL`, teamID, memberID)
+	if err == nil && role == RoleLeader {
+		return nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	return joinTeam(tx, teamID, memberID, RoleLeader, today)
+}
+
+// TeamMember is a person's membership of a team.
+type TeamMember struct {
+	MembershipID int     `json:"membership_id" db:"membership_id"`
+	MemberID     int     `json:"member_id" db:"member_id"`
+	Name         string  `json:"name" db:"name"`
+	Phone        string  `json:"phone" db:"phone"`
+	Email        string  `json:"email" db:"email"`
+	Language     string  `json:"language" db:"language"`
+	IsActive     bool    `json:"is_active" db:"is_active"`
+	Role         string  `json:"role" db:"role"`
+	JoinedAt     string  `json:"joined_at" db:"joined_at"`
+	LeftAt       *string `json:"left_at" db:"left_at"`
+}
+
+const teamMemberQuery = `
+    SELECT tm.id as membership_id, m.id as member_id, m.name, m.phone, m.email, m.language,
+           m.is_active, tm.role, DATE(tm.joined_at) as joined_at, DATE(tm.left_at) as left_at
+    FROM team_memberships tm
+    JOIN members m ON m.id = tm.member_id`
+
+// teamExists writes a 404 response and returns false if there is no such
+// team.
+func teamExists(c *gin.Context, q sqlx.Queryer, teamID string) bool {
+	var exists int
+	if err := sqlx.Get(q, &exists, "SELECT COUNT(*) FROM teams WHERE id = ?", teamID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch team"})
+		return false
+	}
+	if exists == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		return false
+	}
+	return true
+}
+
+// GetTeamMembers lists a team's current members, leader first. With
+// include_former=true past memberships are listed too.
+func GetTeamMembers(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID := c.Param("id")
+		if !teamExists(c, db, teamID) {
+			return
+		}
+
+		query := teamMemberQuery + " WHERE tm.team_id = ?"
+		if c.Query("include_former") != "true" {
+			query += " AND tm.left_at IS NULL"
+		}
+		query += ` ORDER BY tm.left_at IS NOT NULL,
+            CASE tm.role WHEN 'leader' THEN 0 WHEN 'assistant' THEN 1 ELSE 2 END, tm.joined_at, tm.id`
+
+		members := []TeamMember{}
+		if err := db.Select(&members, query, teamID); err != nil {
+			log.Printf("Error fetching members of team %s: %v", teamID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch team members"})
+			return
+		}
+		c.JSON(http.StatusOK, members)
+	}
+}
+
+type AddTeamMemberRequest struct {
+	// MemberID picks an existing person. Without it the person is found by
+	// name, or added with the contact details given.
+	MemberID *int   `json:"member_id"`
+	Name     string `json:"name"`
+	Phone    string `json:"phone"`
+	Email    string `json:"email"`
+	Language string `json:"language"`
+	// Role defaults to member; JoinedAt (YYYY-MM-DD) to today.
+	Role     string `json:"role"`
+	JoinedAt string `json:"joined_at"`
+}
+
+// AddTeamMember adds a person to a team, or changes the role of someone
+// already on it. Making someone leader replaces the current leader, who
+// stays on as a member; a person who leads another team can't lead this one.
+func AddTeamMember(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team id"})
+			return
+		}
+		var request AddTeamMemberRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		if request.Role == "" {
+			request.Role = RoleMember
+		}
+		if request.Role != RoleLeader && request.Role != RoleAssistant && request.Role != RoleMember {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be leader, assistant or member"})
+			return
+		}
+		if request.JoinedAt == "" {
+			request.JoinedAt = time.Now().Format("2006-01-02")
+		}
+		if _, err := time.Parse("2006-01-02", request.JoinedAt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid joined_at, expected YYYY-MM-DD"})
+			return
+		}
+		request.Name = strings.TrimSpace(request.Name)
+		if request.MemberID == nil && request.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Give a member_id or a name"})
+			return
+		}
+
+		tx, err := db.Beginx()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+			return
+		}
+		defer tx.Rollback()
+
+		if !teamExists(c, tx, strconv.Itoa(teamID)) {
+			return
+		}
+
+		var memberID int
+		if request.MemberID != nil {
+			memberID = *request.MemberID
+		} else {
+			memberID, err = findOrCreateMember(tx, request.Name)
+			if err == nil {
+				// Fill in contact details the member doesn't have yet.
+				_, err = tx.Exec(`
+                    UPDATE members SET
+                        phone = CASE WHEN phone = '' THEN ? ELSE phone END,
+                        email = CASE WHEN email = '' THEN ? ELSE email END,
+                        language = CASE WHEN language = '' THEN ? ELSE language END
+                    WHERE id = ?`,
+					strings.TrimSpace(request.Phone), strings.TrimSpace(request.Email),
+					strings.TrimSpace(request.Language), memberID)
+			}
+		}
+		var active bool
+		if err == nil {
+			err = tx.Get(&active, "SELECT is_active FROM members WHERE id = ?", memberID)
+		}
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error finding member for team %d: %v", teamID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add team member"})
+			return
+		}
+		if !active {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Member is inactive"})
+			return
+		}
+
+		var role string
+		err = tx.Get(&role, `
+            SELECT role FROM team_memberships
+            WHERE team_id = ? AND member_id = ? AND left_at IS NULL`, teamID, memberID)
+		if err == nil && role == request.Role {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Member is already on the team as %s", role)})
+			return
+		}
+
+		var conflict *rosterConflict
+		switch err := joinTeam(tx, teamID, memberID, request.Role, request.JoinedAt); {
+		case errors.As(err, &conflict):
+			c.JSON(http.StatusConflict, gin.H{"error": conflict.Error()})
+			return
+		case err != nil:
+			log.Printf("Error adding member %d to team %d: %v", memberID, teamID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add team member"})
+			return
+		}
+
+		var member TeamMember
+		err = tx.Get(&member, teamMemberQuery+" WHERE tm.team_id = ? AND tm.member_id = ? AND tm.left_at IS NULL", teamID, memberID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch team member"})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, member)
+	}
+}
+
+// RemoveTeamMember ends a person's membership of a team as of today. The
+// membership stays in the team's history.
+func RemoveTeamMember(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID, memberID := c.Param("id"), c.Param("memberId")
+		result, err := db.Exec(`
+            UPDATE team_memberships SET left_at = ?
+            WHERE team_id = ? AND member_id = ? AND left_at IS NULL`,
+			time.Now().Format("2006-01-02"), teamID, memberID)
+		if err != nil {
+			log.Printf("Error removing member %s from team %s: %v", memberID, teamID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove team member"})
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Member is not on the team"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Member removed from team"})
+	}
+}
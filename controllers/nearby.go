@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"team-tracker-backend/geo"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	defaultNearbyRadius = 5000   // metres
+	maxNearbyRadius     = 100000 // metres
+	defaultNearbyLimit  = 20
+	maxNearbyLimit      = 500
+)
+
+// NearbyLocation is a location with its distance from the search point.
+type NearbyLocation struct {
+	Location
+	DistanceM float64 `json:"distance_m"`
+}
+
+// GetNearbyLocations lists the active locations within radius_m metres of
+// lat/lon, nearest first. Distance is great-circle distance to the nearest
+// edge of a territory, or 0 when the point is inside it. The spatial index
+// narrows the candidates to the bounding box of the search circle.
+func GetNearbyLocations(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		center, err := parsePosition(c.Query("lat"), c.Query("lon"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		radius, err := strconv.ParseFloat(c.DefaultQuery("radius_m", strconv.Itoa(defaultNearbyRadius)), 64)
+		if err != nil || radius <= 0 || radius > maxNearbyRadius {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("radius_m must be between 0 and %d", maxNearbyRadius)})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultNearbyLimit)))
+		if err != nil || limit < 1 || limit > maxNearbyLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxNearbyLimit)})
+			return
+		}
+
+		minLon, minLat, maxLon, maxLat := geo.BoundsAround(center, radius)
+		candidates, err := selectLocationShapes(db, "id IN ("+locationsInBox+")", minLon, maxLon, minLat, maxLat)
+		if err != nil {
+			log.Printf("Error fetching nearby locations: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+			return
+		}
+
+		nearby := []NearbyLocation{}
+		for _, loc := range candidates {
+			if d := loc.Geometry.DistanceTo(center); d <= radius {
+				nearby = append(nearby, NearbyLocation{Location: loc.Location, DistanceM: d})
+			}
+		}
+		sort.SliceStable(nearby, func(i, j int) bool { return nearby[i].DistanceM < nearby[j].DistanceM })
+		if len(nearby) > limit {
+			nearby = nearby[:limit]
+		}
+
+		c.JSON(http.StatusOK, nearby)
+	}
+}
+
+// locationShape is an active location with its decoded geometry.
+type locationShape struct {
+	Location
+	Geometry geo.Geometry
+}
+
+// selectLocationShapes loads the active locations matching a condition,
+// ordered by id, with their geometry decoded. Rows with unreadable geometry
+// fall back to their point.
+func selectLocationShapes(q sqlx.Queryer, where string, args ...interface{}) ([]locationShape, error) {
+	var rows []struct {
+		Location
+		Geometry *string `db:"geometry"`
+	}
+	query := "SELECT " + locationColumns + ", geometry FROM locations WHERE is_retired = FALSE AND " + where + " ORDER BY id"
+	if err := sqlx.Select(q, &rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	shapes := make([]locationShape, len(rows))
+	for i, row := range rows {
+		geometry, err := decodeGeometry(row.Geometry, row.Latitude, row.Longitude)
+		if err != nil {
+			log.Printf("Invalid geometry stored for location %d: %v", row.ID, err)
+			geometry = geo.NewPoint(row.Longitude, row.Latitude)
+		}
+		shapes[i] = locationShape{Location: row.Location, Geometry: geometry}
+	}
+	return shapes, nil
+}
+
+func parsePosition(latValue, lonValue string) (geo.Position, error) {
+	lat, err := strconv.ParseFloat(latValue, 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return geo.Position{}, fmt.Errorf("lat must be a latitude between -90 and 90")
+	}
+	lon, err := strconv.ParseFloat(lonValue, 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return geo.Position{}, fmt.Errorf("lon must be a longitude between -180 and 180")
+	}
+	return geo.Position{lon, lat}, nil
+}
+
+// parseBBox reads a minLon,minLat,maxLon,maxLat box.
+func parseBBox(value string) (*[4]float64, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat")
+	}
+
+	var box [4]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat")
+		}
+		box[i] = v
+	}
+	if box[0] > box[2] || box[1] > box[3] {
+		return nil, fmt.Errorf("bbox minimum must not exceed its maximum")
+	}
+	return &box, nil
+}
+
+// LocationsAt returns the active territories whose polygons contain the
+// point, smallest first so a territory nested inside a larger one comes
+// before it.
+func LocationsAt(db *sqlx.DB, lat, lon float64) ([]Location, error) {
+	pos := geo.Position{lon, lat}
+	candidates, err := selectLocationShapes(db, "id IN ("+locationsInBox+")", lon, lon, lat, lat)
+	if err != nil {
+		return nil, err
+	}
+
+	var containing []locationShape
+	for _, loc := range candidates {
+		if loc.Geometry.Contains(pos) {
+			containing = append(containing, loc)
+		}
+	}
+	sort.SliceStable(containing, func(i, j int) bool {
+		return containing[i].Geometry.Area() < containing[j].Geometry.Area()
+	})
+
+	locations := make([]Location, len(containing))
+	for i, loc := range containing {
+		locations[i] = loc.Location
+	}
+	return locations, nil
+}
+
+// GetLocationsAt lists the territories containing lat/lon, smallest first.
+func GetLocationsAt(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pos, err := parsePosition(c.Query("lat"), c.Query("lon"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		locations, err := LocationsAt(db, pos.Lat(), pos.Lon())
+		if err != nil {
+			log.Printf("Error looking up locations at %v: %v", pos, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+			return
+		}
+
+		c.JSON(http.StatusOK, locations)
+	}
+}
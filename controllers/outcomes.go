@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// outcomeCodePattern is the shape of an outcome code: lower case words
+// joined by underscores, like nobody_home.
+var outcomeCodePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// VisitOutcome is an entry in the catalog of outcomes a visit can record.
+type VisitOutcome struct {
+	ID               int    `json:"id" db:"id"`
+	Code             string `json:"code" db:"code"`
+	Label            string `json:"label" db:"label"`
+	CountsAsPreached bool   `json:"counts_as_preached" db:"counts_as_preached"`
+	IsActive         bool   `json:"is_active" db:"is_active"`
+	SortOrder        int    `json:"sort_order" db:"sort_order"`
+}
+
+const visitOutcomeColumns = "id, code, label, counts_as_preached, is_active, sort_order"
+
+// VisitOutcomeCount is how many of an outcome a visit recorded. A visit is
+// recorded with either the outcome's code or its id; Count defaults to 1.
+type VisitOutcomeCount struct {
+	OutcomeID int    `json:"outcome_id" db:"outcome_id"`
+	Code      string `json:"code" db:"code"`
+	Label     string `json:"label" db:"label"`
+	Count     *int   `json:"count" db:"count"`
+}
+
+// resolveOutcomes checks the outcomes given for a visit against the active
+// catalog, fills in their ids, labels and counts, and reports whether they
+// preach the location.
+func resolveOutcomes(q sqlx.Queryer, outcomes []VisitOutcomeCount) (preached bool, err error) {
+	seen := make(map[int]bool)
+	for i := range outcomes {
+		o := &outcomes[i]
+		var entry VisitOutcome
+		if o.OutcomeID != 0 {
+			err = sqlx.Get(q, &entry, "SELECT "+visitOutcomeColumns+" FROM visit_outcomes WHERE id = ?", o.OutcomeID)
+		} else {
+			err = sqlx.Get(q, &entry, "SELECT "+visitOutcomeColumns+" FROM visit_outcomes WHERE code = ?", o.Code)
+		}
+		if err == sql.ErrNoRows || (err == nil && !entry.IsActive) {
+			return false, &invalidOutcome{fmt.Sprintf("Unknown visit outcome %q", outcomeName(*o))}
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch visit outcome: %v", err)
+		}
+		if seen[entry.ID] {
+			return false, &invalidOutcome{fmt.Sprintf("Visit outcome %q is listed twice", entry.Code)}
+		}
+		seen[entry.ID] = true
+		if o.Count == nil {
+			one := 1
+			o.Count = &one
+		}
+		if *o.Count < 0 {
+			return false, &invalidOutcome{fmt.Sprintf("The count of %q can't be negative", entry.Code)}
+		}
+
+		o.OutcomeID, o.Code, o.Label = entry.ID, entry.Code, entry.Label
+		preached = preached || (entry.CountsAsPreached && *o.Count > 0)
+	}
+	return preached, nil
+}
+
+func outcomeName(o VisitOutcomeCount) string {
+	if o.Code != "" {
+		return o.Code
+	}
+	return fmt.Sprint(o.OutcomeID)
+}
+
+// invalidOutcome is an outcome the client sent that can't be recorded.
+type invalidOutcome struct{ message string }
+
+func (e *invalidOutcome) Error() string { return e.message }
+
+// saveVisitOutcomes records the resolved outcomes of a visit.
+func saveVisitOutcomes(tx *sqlx.Tx, visitID int, outcomes []VisitOutcomeCount) error {
+	for _, o := range outcomes {
+		_, err := tx.Exec(`
+            INSERT INTO location_visit_outcomes (visit_id, outcome_id, count)
+            VALUES (?, ?, ?)`, visitID, o.OutcomeID, *o.Count)
+		if err != nil {
+			return fmt.Errorf("failed to record visit outcome %s: %v", o.Code, err)
+		}
+	}
+	return nil
+}
+
+// visitOutcomeBatch is how many visits visitOutcomes looks up per query,
+// keeping well under SQLite's limit on query parameters.
+const visitOutcomeBatch = 500
+
+// visitOutcomes loads the outcomes of the given visits, keyed by visit id.
+// Every visit gets a slice, empty if it recorded no outcomes.
+func visitOutcomes(q sqlx.Queryer, visitIDs []int) (map[int][]VisitOutcomeCount, error) {
+	byVisit := make(map[int][]VisitOutcomeCount, len(visitIDs))
+	for _, id := range visitIDs {
+		byVisit[id] = []VisitOutcomeCount{}
+	}
+	for start := 0; start < len(visitIDs); start += visitOutcomeBatch {
+		batch := visitIDs[start:min(start+visitOutcomeBatch, len(visitIDs))]
+		query, args, err := sqlx.In(`
+            SELECT o.visit_id, o.outcome_id, vo.code, vo.label, o.count
+            FROM location_visit_outcomes o
+            JOIN visit_outcomes vo ON vo.id = o.outcome_id
+            WHERE o.visit_id IN (?)
+            ORDER BY vo.sort_order, vo.id`, batch)
+		if err != nil {
+			return nil, err
+		}
+		var rows []struct {
+			VisitID int `db:"visit_id"`
+			VisitOutcomeCount
+		}
+		if err := sqlx.Select(q, &rows, query, args...); err != nil {
+			return nil, fmt.Errorf("failed to fetch visit outcomes: %v", err)
+		}
+		for _, row := range rows {
+			byVisit[row.VisitID] = append(byVisit[row.VisitID], row.VisitOutcomeCount)
+		}
+	}
+	return byVisit, nil
+}
+
+// OutcomeTotal is how often an outcome was recorded over a period: on how
+// many visits, and the sum of its counts.
+type OutcomeTotal struct {
+	OutcomeID        int    `json:"outcome_id" db:"outcome_id"`
+	Code             string `json:"code" db:"code"`
+	Label            string `json:"label" db:"label"`
+	CountsAsPreached bool   `json:"counts_as_preached" db:"counts_as_preached"`
+	Visits           int    `json:"visits" db:"visits"`
+	Total            int    `json:"total" db:"total"`
+}
+
+// outcomeTotals adds up the outcomes of visits from from to to, both local
+// YYYY-MM-DD dates and inclusive; empty means unbounded. Every active outcome is
+// listed, and inactive ones that were recorded in the period.
+func outcomeTotals(q sqlx.Queryer, from, to string) ([]OutcomeTotal, error) {
+	totals := []OutcomeTotal{}
+	err := sqlx.Select(q, &totals, `
+        SELECT
+            vo.id as outcome_id,
+            vo.code,
+            vo.label,
+            vo.counts_as_preached,
+            COUNT(r.visit_id) as visits,
+            COALESCE(SUM(r.count), 0) as total
+        FROM visit_outcomes vo
+        LEFT JOIN (
+            SELECT o.visit_id, o.outcome_id, o.count
+            FROM location_visit_outcomes o
+            JOIN location_visits v ON v.id = o.visit_id
+            WHERE (? = '' OR DATE(v.visit_date, 'localtime') >= ?)
+              AND (? = '' OR DATE(v.visit_date, 'localtime') <= ?)
+        ) r ON r.outcome_id = vo.id
+        GROUP BY vo.id
+        HAVING vo.is_active OR COUNT(r.visit_id) > 0
+        ORDER BY vo.sort_order, vo.id`, from, from, to, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add up visit outcomes: %v", err)
+	}
+	return totals, nil
+}
+
+// OutcomeTotals adds up the outcomes of every visit, for the statistics.
+func OutcomeTotals(q sqlx.Queryer) ([]OutcomeTotal, error) {
+	return outcomeTotals(q, "", "")
+}
+
+// GetVisitOutcomes lists the outcome catalog in display order. Inactive
+// outcomes are included with ?include_inactive=true.
+func GetVisitOutcomes(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := "SELECT " + visitOutcomeColumns + " FROM visit_outcomes"
+		if c.Query("include_inactive") != "true" {
+			query += " WHERE is_active = TRUE"
+		}
+		outcomes := []VisitOutcome{}
+		if err := db.Select(&outcomes, query+" ORDER BY sort_order, id"); err != nil {
+			log.Printf("Error fetching visit outcomes: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch visit outcomes"})
+			return
+		}
+
+		c.JSON(http.StatusOK, outcomes)
+	}
+}
+
+// AddVisitOutcome adds an outcome to the catalog.
+func AddVisitOutcome(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var outcome VisitOutcome
+		if err := c.ShouldBindJSON(&outcome); err != nil || strings.TrimSpace(outcome.Label) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		if !outcomeCodePattern.MatchString(outcome.Code) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "code must be lower case letters, digits and underscores"})
+			return
+		}
+
+		var exists int
+		if err := db.Get(&exists, "SELECT COUNT(*) FROM visit_outcomes WHERE code = ?", outcome.Code); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create visit outcome"})
+			return
+		}
+		if exists > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Visit outcome %q already exists", outcome.Code)})
+			return
+		}
+
+		result, err := db.Exec(`
+            INSERT INTO visit_outcomes (code, label, counts_as_preached, sort_order)
+            VALUES (?, ?, ?, ?)`, outcome.Code, outcome.Label, outcome.CountsAsPreached, outcome.SortOrder)
+		if err != nil {
+			log.Printf("Error creating visit outcome: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create visit outcome"})
+			return
+		}
+		id, _ := result.LastInsertId()
+		outcome.ID = int(id)
+		outcome.IsActive = true
+
+		c.JSON(http.StatusCreated, outcome)
+	}
+}
+
+// UpdateVisitOutcomeRequest changes an outcome; missing fields are left as
+// they are. The code can't change, since clients record visits by it.
+type UpdateVisitOutcomeRequest struct {
+	Label            *string `json:"label"`
+	CountsAsPreached *bool   `json:"counts_as_preached"`
+	IsActive         *bool   `json:"is_active"`
+	SortOrder        *int    `json:"sort_order"`
+}
+
+// UpdateVisitOutcome changes an outcome in the catalog. Changing whether it
+// counts as preached re-derives the preached status of the visits that
+// recorded it, and of their locations in the current campaign.
+func UpdateVisitOutcome(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var request UpdateVisitOutcomeRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		if request.Label != nil && strings.TrimSpace(*request.Label) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "label can't be empty"})
+			return
+		}
+
+		tx, err := db.Beginx()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+			return
+		}
+		defer tx.Rollback()
+
+		var outcome VisitOutcome
+		err = tx.Get(&outcome, "SELECT "+visitOutcomeColumns+" FROM visit_outcomes WHERE id = ?", id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Visit outcome not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch visit outcome"})
+			return
+		}
+
+		rederive := request.CountsAsPreached != nil && *request.CountsAsPreached != outcome.CountsAsPreached
+		if request.Label != nil {
+			outcome.Label = *request.Label
+		}
+		if request.CountsAsPreached != nil {
+			outcome.CountsAsPreached = *request.CountsAsPreached
+		}
+		if request.IsActive != nil {
+			outcome.IsActive = *request.IsActive
+		}
+		if request.SortOrder != nil {
+			outcome.SortOrder = *request.SortOrder
+		}
+
+		_, err = tx.Exec(`
+            UPDATE visit_outcomes SET label = ?, counts_as_preached = ?, is_active = ?, sort_order = ?
+            WHERE id = ?`, outcome.Label, outcome.CountsAsPreached, outcome.IsActive, outcome.SortOrder, outcome.ID)
+		if err == nil && rederive {
+			err = rederivePreached(tx, outcome.ID)
+		}
+		if err != nil {
+			log.Printf("Error updating visit outcome %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update visit outcome"})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusOK, outcome)
+	}
+}
+
+// rederivePreached recomputes is_preached for the visits that recorded an
+// outcome, then for locations in the current campaign.
+func rederivePreached(tx *sqlx.Tx, outcomeID int) error {
+	_, err := tx.Exec(`
+        UPDATE location_visits SET is_preached = EXISTS (
+            SELECT 1 FROM location_visit_outcomes o
+            JOIN visit_outcomes vo ON vo.id = o.outcome_id
+            WHERE o.visit_id = location_visits.id AND vo.counts_as_preached AND o.count > 0)
+        WHERE id IN (SELECT visit_id FROM location_visit_outcomes WHERE outcome_id = ?)`, outcomeID)
+	if err != nil {
+		return fmt.Errorf("failed to re-derive preached visits: %v", err)
+	}
+
+	var campaignID int
+	switch err := tx.Get(&campaignID, currentCampaignID, campaignDate()); {
+	case err == sql.ErrNoRows:
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to fetch current campaign: %v", err)
+	}
+	return refreshPreached(tx, campaignID)
+}
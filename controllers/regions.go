@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+type Region struct {
+	ID            int    `json:"id" db:"id"`
+	Name          string `json:"name" db:"name"`
+	ParentID      *int   `json:"parent_id" db:"parent_id"`
+	Path          string `json:"path" db:"path"`
+	Depth         int    `json:"depth" db:"depth"`
+	LocationCount int    `json:"location_count" db:"location_count"`
+	// TotalLocationCount includes the locations of every descendant region.
+	TotalLocationCount int `json:"total_location_count" db:"-"`
+}
+
+// regionSubtree selects the ids of the seed regions and all their
+// descendants. The seed condition is filled in by the caller.
+const regionSubtree = `
+    WITH RECURSIVE subtree(id) AS (
+        SELECT id FROM regions WHERE %s
+        UNION
+        SELECT r.id FROM regions r JOIN subtree s ON r.parent_id = s.id
+    )
+    SELECT id FROM subtree`
+
+// GetRegions lists every region in hierarchy order with its path from the
+// top-level region and its location counts.
+func GetRegions(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var regions []Region
+
+		query := `
+        WITH RECURSIVE tree(id, path, depth, sort_path) AS (
+            SELECT id, name, 0, printf('%08d', id) FROM regions WHERE parent_id IS NULL
+            UNION ALL
+            SELECT r.id, t.path || ' / ' || r.name, t.depth + 1, t.sort_path || '/' || printf('%08d', r.id)
+            FROM regions r
+            JOIN tree t ON r.parent_id = t.id
+        )
+        SELECT
+            r.id,
+            r.name,
+            r.parent_id,
+            t.path,
+            t.depth,
+            (SELECT COUNT(*) FROM locations l
+             WHERE l.region_id = r.id AND l.is_retired = FALSE) as location_count
+        FROM regions r
+        JOIN tree t ON t.id = r.id
+        ORDER BY t.sort_path
+    `
+
+		if err := db.Select(&regions, query); err != nil {
+			log.Printf("Error fetching regions: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch regions"})
+			return
+		}
+
+		// Roll counts up from the deepest regions to their ancestors.
+		index := make(map[int]int, len(regions))
+		for i := range regions {
+			index[regions[i].ID] = i
+			regions[i].TotalLocationCount = regions[i].LocationCount
+		}
+		for i := len(regions) - 1; i >= 0; i-- {
+			if parent := regions[i].ParentID; parent != nil {
+				if j, ok := index[*parent]; ok {
+					regions[j].TotalLocationCount += regions[i].TotalLocationCount
+				}
+			}
+		}
+
+		c.JSON(http.StatusOK, regions)
+	}
+}
+
+// GetRegionLocations lists the locations in a region, including those in its
+// subregions unless include_subregions=false.
+func GetRegionLocations(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		var exists int
+		err := db.Get(&exists, "SELECT 1 FROM regions WHERE id = ?", id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Region not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch region"})
+			return
+		}
+
+		filter := locationFilter{RegionID: id, IncludeSubregions: c.DefaultQuery("include_subregions", "true") != "false"}
+		locations, err := selectLocations(db, filter)
+		if err != nil {
+			log.Printf("Error fetching region locations: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+			return
+		}
+
+		c.JSON(http.StatusOK, locations)
+	}
+}
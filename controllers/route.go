@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"team-tracker-backend/geo"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Travel time estimates. Distances are straight lines, so they are stretched
+// by detourFactor to approximate the streets actually travelled.
+const (
+	walkingSpeed = 5000.0 / 60  // metres per minute (5 km/h)
+	drivingSpeed = 40000.0 / 60 // metres per minute (40 km/h in town)
+	detourFactor = 1.3
+)
+
+type RouteStop struct {
+	Sequence       int     `json:"sequence"`
+	PlannedVisitID int     `json:"planned_visit_id"`
+	LocationID     int     `json:"location_id"`
+	Name           string  `json:"name"`
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	Address        string  `json:"address"`
+}
+
+// RouteLeg is the trip to a stop from the previous one, or from the start
+// point for the first stop.
+type RouteLeg struct {
+	FromLocationID *int    `json:"from_location_id"`
+	ToLocationID   int     `json:"to_location_id"`
+	DistanceM      float64 `json:"distance_m"`
+	WalkingMinutes float64 `json:"walking_minutes"`
+	DrivingMinutes float64 `json:"driving_minutes"`
+}
+
+type PlannedRoute struct {
+	Team           string        `json:"team"`
+	Date           string        `json:"date"`
+	Start          *geo.Position `json:"start"`
+	TotalDistanceM float64       `json:"total_distance_m"`
+	WalkingMinutes float64       `json:"walking_minutes"`
+	DrivingMinutes float64       `json:"driving_minutes"`
+	Stops          []RouteStop   `json:"stops"`
+	Legs           []RouteLeg    `json:"legs"`
+}
+
+// GetPlannedRoute orders a team's planned visits for a day (date, default
+// today) into a short route from start_lat/start_lon, or from whichever stop
+// gives the shortest route when no start is given. The order is saved as
+// planned_visits.sequence, which the GPX export follows.
+func GetPlannedRoute(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var start *geo.Position
+		if c.Query("start_lat") != "" || c.Query("start_lon") != "" {
+			pos, err := parsePosition(c.Query("start_lat"), c.Query("start_lon"))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start point: " + err.Error()})
+				return
+			}
+			start = &pos
+		}
+
+		teamName, date, stops, ok := loadTeamPlan(c, db)
+		if !ok {
+			return
+		}
+
+		positions := make([]geo.Position, len(stops))
+		for i, stop := range stops {
+			positions[i] = geo.Position{stop.Longitude, stop.Latitude}
+		}
+		order := geo.OptimizeRoute(start, positions)
+
+		route := PlannedRoute{Team: teamName, Date: date, Start: start, Stops: []RouteStop{}, Legs: []RouteLeg{}}
+		var prev *plannedStop
+		for i, idx := range order {
+			stop := stops[idx]
+			route.Stops = append(route.Stops, RouteStop{
+				Sequence:       i + 1,
+				PlannedVisitID: stop.PlannedVisitID,
+				LocationID:     stop.LocationID,
+				Name:           stop.Name,
+				Latitude:       stop.Latitude,
+				Longitude:      stop.Longitude,
+				Address:        stop.Address,
+			})
+
+			leg := RouteLeg{ToLocationID: stop.LocationID}
+			switch {
+			case prev != nil:
+				leg.FromLocationID = &prev.LocationID
+				leg.DistanceM = geo.Distance(geo.Position{prev.Longitude, prev.Latitude}, positions[idx])
+			case start != nil:
+				leg.DistanceM = geo.Distance(*start, positions[idx])
+			}
+			if prev != nil || start != nil {
+				leg.WalkingMinutes = leg.DistanceM * detourFactor / walkingSpeed
+				leg.DrivingMinutes = leg.DistanceM * detourFactor / drivingSpeed
+				route.Legs = append(route.Legs, leg)
+				route.TotalDistanceM += leg.DistanceM
+				route.WalkingMinutes += leg.WalkingMinutes
+				route.DrivingMinutes += leg.DrivingMinutes
+			}
+			prev = &stops[idx]
+		}
+
+		if err := saveRouteSequence(db, route.Stops); err != nil {
+			log.Printf("Error saving route order: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save route order"})
+			return
+		}
+
+		c.JSON(http.StatusOK, route)
+	}
+}
+
+func saveRouteSequence(db *sqlx.DB, stops []RouteStop) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stop := range stops {
+		if _, err := tx.Exec("UPDATE planned_visits SET sequence = ? WHERE id = ?", stop.Sequence, stop.PlannedVisitID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// SettingLoanDays is how many days a team keeps a territory it checks out
+// before the assignment is overdue.
+const SettingLoanDays = "assignment_loan_days"
+
+// settingDefaults holds the value of each known setting when none is stored.
+var settingDefaults = map[string]string{
+	SettingLoanDays: "120",
+}
+
+// settingValidators check a new value of each known setting.
+var settingValidators = map[string]func(string) error{
+	SettingLoanDays: func(value string) error {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 1 || days > 3650 {
+			return fmt.Errorf("%s must be a whole number of days between 1 and 3650", SettingLoanDays)
+		}
+		return nil
+	},
+}
+
+// setting returns the stored value of a setting, or its default.
+func setting(q sqlx.Queryer, key string) (string, error) {
+	var value string
+	err := sqlx.Get(q, &value, "SELECT value FROM settings WHERE key = ?", key)
+	if err == sql.ErrNoRows {
+		return settingDefaults[key], nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read setting %s: %v", key, err)
+	}
+	return value, nil
+}
+
+func settingInt(q sqlx.Queryer, key string) (int, error) {
+	value, err := setting(q, key)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("setting %s is not a number: %q", key, value)
+	}
+	return n, nil
+}
+
+// Setting is a setting with its current value.
+type Setting struct {
+	Key       string     `json:"key" db:"key"`
+	Value     string     `json:"value" db:"value"`
+	UpdatedAt *time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// GetSettings lists every known setting with its value.
+func GetSettings(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stored := []Setting{}
+		if err := db.Select(&stored, "SELECT key, value, updated_at FROM settings ORDER BY key"); err != nil {
+			log.Printf("Error fetching settings: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings"})
+			return
+		}
+
+		settings := []Setting{}
+		seen := map[string]bool{}
+		for _, s := range stored {
+			if _, ok := settingDefaults[s.Key]; ok {
+				settings = append(settings, s)
+				seen[s.Key] = true
+			}
+		}
+		for key, value := range settingDefaults {
+			if !seen[key] {
+				settings = append(settings, Setting{Key: key, Value: value})
+			}
+		}
+
+		c.JSON(http.StatusOK, settings)
+	}
+}
+
+// UpdateSetting sets the value of a known setting.
+func UpdateSetting(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Param("key")
+		validate, ok := settingValidators[key]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown setting"})
+			return
+		}
+		var request struct {
+			Value string `json:"value"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		if err := validate(request.Value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		_, err := db.Exec(`
+            INSERT INTO settings (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+            ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+			key, request.Value)
+		if err != nil {
+			log.Printf("Error updating setting %s: %v", key, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update setting"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"key": key, "value": request.Value})
+	}
+}
@@ -1,23 +1,47 @@
 package controllers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 )
 
+// Team is a team with its current leader and the names of its other
+// members, both taken from its memberships.
 type Team struct {
-	ID     int    `json:"id"`
-	Name   string `json:"name"`
-	Leader string `json:"leader"`
+	ID       int    `json:"id" db:"id"`
+	Name     string `json:"name" db:"name"`
+	Leader   string `json:"leader" db:"leader"`
+	LeaderID *int   `json:"leader_id" db:"leader_id"`
+	Members  string `json:"members" db:"members"`
+}
+
+// TeamRequest creates or updates a team. Leader is a person's name; they are
+// added as a member if they aren't one yet. On update a missing leader
+// leaves the leader unchanged and an empty one removes the team's leader.
+type TeamRequest struct {
+	Name   string  `json:"name"`
+	Leader *string `json:"leader"`
+}
+
+func selectTeam(q sqlx.Queryer, id int) (Team, error) {
+	var team Team
+	err := sqlx.Get(q, &team, "SELECT t.id, t.name, "+teamRosterColumns+" FROM teams t WHERE t.id = ?", id)
+	return team, err
 }
 
 func GetTeams(db *sqlx.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var teams []Team
-		err := db.Select(&teams, "SELECT * FROM teams")
+		teams := []Team{}
+		err := db.Select(&teams, "SELECT t.id, t.name, "+teamRosterColumns+" FROM teams t ORDER BY t.id")
 		if err != nil {
+			log.Printf("Error fetching teams: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch teams"})
 			return
 		}
@@ -27,49 +51,135 @@ func GetTeams(db *sqlx.DB) gin.HandlerFunc {
 
 func AddTeam(db *sqlx.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var team Team
-		if err := c.ShouldBindJSON(&team); err != nil {
+		var request TeamRequest
+		if err := c.ShouldBindJSON(&request); err != nil || strings.TrimSpace(request.Name) == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 			return
 		}
 
-		_, err := db.Exec("INSERT INTO teams (name, leader) VALUES (?, ?)", team.Name, team.Leader)
+		tx, err := db.Beginx()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add team"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
 			return
 		}
-		c.JSON(http.StatusCreated, gin.H{"message": "Team added successfully"})
-	}
-}
+		defer tx.Rollback()
 
-// Delete a team
-func DeleteTeam(db *sqlx.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		id := c.Param("id")
-		_, err := db.Exec("DELETE FROM teams WHERE id = ?", id)
+		result, err := tx.Exec("INSERT INTO teams (name, leader) VALUES (?, '')", request.Name)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete team"})
+			log.Printf("Error creating team: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create team"})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "Team deleted successfully"})
+		id, _ := result.LastInsertId()
+		saveTeam(c, tx, int(id), request.Leader, http.StatusCreated)
 	}
 }
 
 // Update a team
 func UpdateTeam(db *sqlx.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		var team Team
-		if err := c.ShouldBindJSON(&team); err != nil {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team id"})
+			return
+		}
+		var request TeamRequest
+		if err := c.ShouldBindJSON(&request); err != nil || strings.TrimSpace(request.Name) == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 			return
 		}
 
-		_, err := db.Exec("UPDATE teams SET name = ?, leader = ? WHERE id = ?", team.Name, team.Leader, id)
+		tx, err := db.Beginx()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+			return
+		}
+		defer tx.Rollback()
+
+		result, err := tx.Exec("UPDATE teams SET name = ? WHERE id = ?", request.Name, id)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update team"})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "Team updated successfully"})
+		if n, _ := result.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+			return
+		}
+		saveTeam(c, tx, id, request.Leader, http.StatusOK)
+	}
+}
+
+// saveTeam sets the leader of a created or updated team, if one was given,
+// commits and replies with the team.
+func saveTeam(c *gin.Context, tx *sqlx.Tx, id int, leader *string, status int) {
+	if leader != nil {
+		var conflict *rosterConflict
+		switch err := setTeamLeader(tx, id, *leader); {
+		case errors.As(err, &conflict):
+			c.JSON(http.StatusConflict, gin.H{"error": conflict.Error()})
+			return
+		case err != nil:
+			log.Printf("Error setting leader of team %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set team leader"})
+			return
+		}
+	}
+
+	team, err := selectTeam(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch team"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	c.JSON(status, team)
+}
+
+// Delete a team. Its current memberships end today and stay in the roster
+// history. Its open assignments are returned and its assignments removed;
+// the assignment history keeps the record of what it worked.
+// ?actor= names who deleted it, for the history.
+func DeleteTeam(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		tx, err := db.Beginx()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+			return
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(`
+            UPDATE team_memberships SET left_at = ?
+            WHERE team_id = ? AND left_at IS NULL`, time.Now().Format("2006-01-02"), id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete team"})
+			return
+		}
+		_, err = tx.Exec(`
+            INSERT INTO assignment_events (assignment_id, team_id, location_id, from_status, to_status,
+                                           action, note, actor, team_name, location_name)
+            SELECT ta.id, ta.team_id, ta.location_id, ta.status, 'returned', ?, 'team deleted', ?,
+                   `+eventSnapshot+`
+            FROM team_assignments ta WHERE ta.team_id = ? AND `+openAssignment+`
+            ORDER BY ta.id`, ActionReturned, c.Query("actor"), id)
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM team_assignments WHERE team_id = ?", id)
+		}
+		if err != nil {
+			log.Printf("Error returning assignments of team %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete team"})
+			return
+		}
+		if _, err := tx.Exec("DELETE FROM teams WHERE id = ?", id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete team"})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Team deleted successfully"})
 	}
 }
@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+type LocationVisit struct {
+	ID         int       `json:"id" db:"id"`
+	LocationID int       `json:"location_id" db:"location_id"`
+	TeamID     int       `json:"team_id" db:"team_id"`
+	VisitDate  time.Time `json:"visit_date" db:"visit_date"`
+	// IsPreached is derived from Outcomes when any are given. Older clients
+	// send only IsPreached, which is recorded as the preached outcome.
+	IsPreached bool                `json:"is_preached" db:"is_preached"`
+	Notes      string              `json:"notes" db:"notes"`
+	Outcomes   []VisitOutcomeCount `json:"outcomes" db:"-"`
+	// Latitude and Longitude can be sent instead of LocationID to record a
+	// visit at the territory containing a GPS fix.
+	Latitude  *float64 `json:"latitude,omitempty" db:"-"`
+	Longitude *float64 `json:"longitude,omitempty" db:"-"`
+}
+
+const locationVisitColumns = "id, location_id, team_id, visit_date, is_preached, COALESCE(notes, '') as notes"
+
+// RecordVisit records a visit to a location with its outcomes.
+func RecordVisit(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var visit LocationVisit
+		if err := c.ShouldBindJSON(&visit); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if visit.LocationID == 0 {
+			if visit.Latitude == nil || visit.Longitude == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "location_id or latitude and longitude are required"})
+				return
+			}
+
+			// Resolve the territory containing the point, preferring the
+			// smallest when territories overlap.
+			locations, err := LocationsAt(db, *visit.Latitude, *visit.Longitude)
+			if err != nil {
+				log.Printf("Error resolving visit location: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve location"})
+				return
+			}
+			if len(locations) == 0 {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Point is not inside any territory"})
+				return
+			}
+			visit.LocationID = locations[0].ID
+		}
+
+		if len(visit.Outcomes) == 0 && visit.IsPreached {
+			visit.Outcomes = []VisitOutcomeCount{{Code: "preached"}}
+		}
+		if visit.Outcomes == nil {
+			visit.Outcomes = []VisitOutcomeCount{}
+		}
+
+		tx, err := db.Beginx()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+			return
+		}
+		defer tx.Rollback()
+
+		var invalid *invalidOutcome
+		visit.IsPreached, err = resolveOutcomes(tx, visit.Outcomes)
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("Error resolving visit outcomes: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record visit"})
+			return
+		}
+
+		visit.VisitDate = time.Now()
+		result, err := tx.Exec(`
+            INSERT INTO location_visits
+            (location_id, team_id, visit_date, is_preached, notes)
+            VALUES (?, ?, ?, ?, ?)`,
+			visit.LocationID, visit.TeamID, visit.VisitDate, visit.IsPreached, visit.Notes)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record visit"})
+			return
+		}
+		id, _ := result.LastInsertId()
+		visit.ID = int(id)
+
+		if err := saveVisitOutcomes(tx, visit.ID, visit.Outcomes); err != nil {
+			log.Printf("Error recording visit %d: %v", visit.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record visit"})
+			return
+		}
+
+		// Update location's preached status if needed
+		if visit.IsPreached {
+			if _, err := tx.Exec("UPDATE locations SET is_preached = true WHERE id = ?", visit.LocationID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location status"})
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, visit)
+	}
+}
+
+// GetLocationVisits returns the visits to a location, newest first,
+// including those to the locations it was split or merged from.
+func GetLocationVisits(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locationID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location id"})
+			return
+		}
+		ancestors, err := locationAncestors(db, locationID)
+		if err != nil {
+			log.Printf("Error fetching lineage of location %d: %v", locationID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch visits"})
+			return
+		}
+
+		visits := []LocationVisit{}
+		query, args, err := sqlx.In(`
+            SELECT `+locationVisitColumns+` FROM location_visits
+            WHERE location_id IN (?)
+            ORDER BY visit_date DESC`, append([]int{locationID}, ancestors...))
+		if err == nil {
+			err = db.Select(&visits, query, args...)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch visits"})
+			return
+		}
+
+		ids := make([]int, len(visits))
+		for i, v := range visits {
+			ids[i] = v.ID
+		}
+		outcomes, err := visitOutcomes(db, ids)
+		if err != nil {
+			log.Printf("Error fetching visits of location %d: %v", locationID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch visits"})
+			return
+		}
+		for i := range visits {
+			visits[i].Outcomes = outcomes[visits[i].ID]
+		}
+
+		c.JSON(http.StatusOK, visits)
+	}
+}
+
+// VisitHistoryEntry is a visit with its team and location names.
+type VisitHistoryEntry struct {
+	ID           int                 `json:"id" db:"id"`
+	VisitDate    time.Time           `json:"visit_date" db:"visit_date"`
+	TeamName     string              `json:"team_name" db:"team_name"`
+	LocationName string              `json:"location_name" db:"location_name"`
+	IsPreached   bool                `json:"is_preached" db:"is_preached"`
+	Notes        string              `json:"notes" db:"notes"`
+	Outcomes     []VisitOutcomeCount `json:"outcomes" db:"-"`
+}
+
+// GetVisitHistory returns every visit, newest first.
+func GetVisitHistory(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		visits := []VisitHistoryEntry{}
+		err := db.Select(&visits, `
+            SELECT
+                v.id,
+                v.visit_date,
+                t.name as team_name,
+                l.name as location_name,
+                v.is_preached,
+                COALESCE(v.notes, '') as notes
+            FROM location_visits v
+            JOIN teams t ON v.team_id = t.id
+            JOIN locations l ON v.location_id = l.id
+            ORDER BY v.visit_date DESC`)
+		if err != nil {
+			log.Printf("Error fetching visit history: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch visit history"})
+			return
+		}
+
+		ids := make([]int, len(visits))
+		for i, v := range visits {
+			ids[i] = v.ID
+		}
+		outcomes, err := visitOutcomes(db, ids)
+		if err != nil {
+			log.Printf("Error fetching visit history: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch visit history"})
+			return
+		}
+		for i := range visits {
+			visits[i].Outcomes = outcomes[visits[i].ID]
+		}
+
+		c.JSON(http.StatusOK, visits)
+	}
+}
@@ -11,7 +11,10 @@ import (
 
 const DBFileName = "team_tracker.db"
 
-func InitDB() *sqlx.DB {
+// InitDB opens the database file in the working directory, creating it if it
+// does not exist. Existing data is kept unless reset is true, in which case
+// the file is removed first so the caller can re-seed it from scratch.
+func InitDB(reset bool) *sqlx.DB {
 	// Get absolute path to database file
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -21,15 +24,16 @@ func InitDB() *sqlx.DB {
 
 	log.Printf("Initializing database at: %s", dbPath)
 
-	// Remove existing database if it exists
-	if _, err := os.Stat(dbPath); err == nil {
-		log.Printf("Removing existing database file")
-		if err := os.Remove(dbPath); err != nil {
-			log.Fatalf("Failed to remove existing database: %v", err)
+	if reset {
+		if _, err := os.Stat(dbPath); err == nil {
+			log.Printf("Removing existing database file")
+			if err := os.Remove(dbPath); err != nil {
+				log.Fatalf("Failed to remove existing database: %v", err)
+			}
 		}
 	}
 
-	// Open new database connection
+	// Open database connection
 	db, err := sqlx.Open("sqlite3", dbPath)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
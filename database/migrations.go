@@ -1,70 +1,271 @@
 package database
 
 import (
+	"embed"
+	"fmt"
+	"io/fs"
 	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
+// Migrations live in migrations/ as NNNN_name.up.sql / NNNN_name.down.sql
+// pairs and are compiled into the binary.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int        `json:"version" db:"version"`
+	Name      string     `json:"name" db:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty" db:"applied_at"`
+}
+
 // MigrateDB runs database migrations
 func MigrateDB(db *sqlx.DB) {
 	log.Println("Starting database migrations...")
 
-	schema := `
-    CREATE TABLE IF NOT EXISTS locations (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        name TEXT NOT NULL,
-        latitude REAL NOT NULL,
-        longitude REAL NOT NULL,
-        is_preached BOOLEAN DEFAULT FALSE
-    );
+	if err := MigrateUp(db, 0); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+	log.Println("Database migrations completed successfully")
+}
+
+// MigrateUp applies up to steps pending migrations in version order. A steps
+// value of zero or less applies all of them.
+func MigrateUp(db *sqlx.DB, steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		if steps > 0 && count >= steps {
+			break
+		}
+
+		log.Printf("Applying migration %04d_%s", m.Version, m.Name)
+		err := runInTx(db, m.Up, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %v", m.Version, m.Name, err)
+		}
+		count++
+	}
+
+	return nil
+}
+
+// MigrateDown rolls back the most recently applied migrations, newest first.
+// A steps value of zero or less defaults to a single migration.
+func MigrateDown(db *sqlx.DB, steps int) error {
+	if steps <= 0 {
+		steps = 1
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if !applied[m.Version] {
+			continue
+		}
+		if m.Down == "" {
+			return fmt.Errorf("migration %04d_%s has no down script", m.Version, m.Name)
+		}
+
+		log.Printf("Reverting migration %04d_%s", m.Version, m.Name)
+		err := runInTx(db, m.Down, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %04d_%s failed: %v", m.Version, m.Name, err)
+		}
+		count++
+	}
+
+	return nil
+}
+
+// GetMigrationStatus lists every known migration and whether it is applied.
+func GetMigrationStatus(db *sqlx.DB) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
 
-    CREATE TABLE IF NOT EXISTS teams (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
+	var rows []MigrationStatus
+	if err := db.Select(&rows, "SELECT version, name, applied_at FROM schema_migrations"); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	appliedAt := make(map[int]*time.Time, len(rows))
+	for _, r := range rows {
+		appliedAt[r.Version] = r.AppliedAt
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		at, ok := appliedAt[m.Version]
+		statuses = append(statuses, MigrationStatus{
+			Version:   m.Version,
+			Name:      m.Name,
+			Applied:   ok,
+			AppliedAt: at,
+		})
+	}
+	return statuses, nil
+}
+
+func ensureMigrationsTable(db *sqlx.DB) error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS schema_migrations (
+        version INTEGER PRIMARY KEY,
         name TEXT NOT NULL,
-        leader TEXT NOT NULL,
-        location_id INTEGER,
-        FOREIGN KEY(location_id) REFERENCES locations(id)
-    );
-
-    CREATE TABLE IF NOT EXISTS location_visits (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        location_id INTEGER NOT NULL,
-        team_id INTEGER NOT NULL,
-        visit_date DATETIME NOT NULL,
-        is_preached BOOLEAN NOT NULL DEFAULT FALSE,
-        notes TEXT,
-        FOREIGN KEY(location_id) REFERENCES locations(id),
-        FOREIGN KEY(team_id) REFERENCES teams(id)
-    );
-
-    CREATE TABLE IF NOT EXISTS planned_visits (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        location_id INTEGER NOT NULL,
-        team_id INTEGER NOT NULL,
-        planned_date DATE NOT NULL,
-        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-        status TEXT DEFAULT 'planned', -- 'planned', 'completed', 'cancelled'
-        FOREIGN KEY(location_id) REFERENCES locations(id),
-        FOREIGN KEY(team_id) REFERENCES teams(id),
-        UNIQUE(location_id, planned_date)
-    );
-
-CREATE TABLE IF NOT EXISTS team_assignments (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    team_id INTEGER NOT NULL,
-    location_id INTEGER NOT NULL,
-    is_completed BOOLEAN DEFAULT FALSE,
-    assigned_date DATETIME DEFAULT CURRENT_TIMESTAMP,
-    completed_date DATETIME,
-    FOREIGN KEY(team_id) REFERENCES teams(id),
-    FOREIGN KEY(location_id) REFERENCES locations(id),
-    UNIQUE(team_id, location_id)
-);`
-
-	_, err := db.Exec(schema)
+        applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    )`)
 	if err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
 	}
-	log.Println("Database migrations completed successfully")
+	return nil
+}
+
+func appliedVersions(db *sqlx.DB) (map[int]bool, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	if err := db.Select(&versions, "SELECT version FROM schema_migrations"); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+
+	applied := make(map[int]bool, len(versions))
+	for _, v := range versions {
+		applied[v] = true
+	}
+	return applied, nil
+}
+
+// runInTx executes a migration script and its bookkeeping statement in a
+// single transaction so a failed migration leaves no partial schema behind.
+func runInTx(db *sqlx.DB, script string, record func(tx *sqlx.Tx) error) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if strings.TrimSpace(script) != "" {
+		if _, err := tx.Exec(script); err != nil {
+			return err
+		}
+	}
+
+	if err := record(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded migrations: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", fileName)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %v", fileName, err)
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join("migrations", fileName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", fileName, err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration version %d used by both %s and %s", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
 }
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS team_assignments;
+DROP TABLE IF EXISTS planned_visits;
+DROP TABLE IF EXISTS location_visits;
+DROP TABLE IF EXISTS teams;
+DROP TABLE IF EXISTS locations;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_locations_source_key;
+
+ALTER TABLE locations DROP COLUMN retired_at;
+ALTER TABLE locations DROP COLUMN is_retired;
+ALTER TABLE locations DROP COLUMN description;
+ALTER TABLE locations DROP COLUMN source_key;
+ALTER TABLE locations DROP COLUMN source;
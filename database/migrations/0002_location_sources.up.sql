@@ -0,0 +1,9 @@
+-- Track where each location was imported from so re-imports can match
+-- placemarks to existing rows instead of inserting duplicates.
+ALTER TABLE locations ADD COLUMN source TEXT;
+ALTER TABLE locations ADD COLUMN source_key TEXT;
+ALTER TABLE locations ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE locations ADD COLUMN is_retired BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE locations ADD COLUMN retired_at DATETIME;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_locations_source_key ON locations(source, source_key);
@@ -0,0 +1,3 @@
+-- Full GeoJSON geometry for each location. latitude/longitude hold its
+-- centroid so existing clients keep working.
+ALTER TABLE locations ADD COLUMN geometry TEXT;
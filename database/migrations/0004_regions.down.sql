@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_locations_region;
+ALTER TABLE locations DROP COLUMN region_id;
+
+DROP TABLE IF EXISTS regions;
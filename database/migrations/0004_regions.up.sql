@@ -0,0 +1,15 @@
+-- Regions come from KML folders; nested folders become child regions.
+CREATE TABLE IF NOT EXISTS regions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    parent_id INTEGER,
+    source TEXT,
+    source_key TEXT,
+    FOREIGN KEY(parent_id) REFERENCES regions(id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_regions_source_key ON regions(source, source_key);
+CREATE INDEX IF NOT EXISTS idx_regions_parent ON regions(parent_id);
+
+ALTER TABLE locations ADD COLUMN region_id INTEGER REFERENCES regions(id);
+CREATE INDEX IF NOT EXISTS idx_locations_region ON locations(region_id);
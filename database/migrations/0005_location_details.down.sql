@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS location_media;
+
+DROP INDEX IF EXISTS idx_locations_type;
+ALTER TABLE locations DROP COLUMN location_type;
+ALTER TABLE locations DROP COLUMN notes;
+ALTER TABLE locations DROP COLUMN address;
@@ -0,0 +1,16 @@
+-- Structured fields parsed from placemark descriptions. The raw description
+-- is kept in locations.description.
+ALTER TABLE locations ADD COLUMN address TEXT NOT NULL DEFAULT '';
+ALTER TABLE locations ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+ALTER TABLE locations ADD COLUMN location_type TEXT NOT NULL DEFAULT 'other';
+
+CREATE INDEX IF NOT EXISTS idx_locations_type ON locations(location_type);
+
+CREATE TABLE IF NOT EXISTS location_media (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    location_id INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY(location_id) REFERENCES locations(id),
+    UNIQUE(location_id, url)
+);
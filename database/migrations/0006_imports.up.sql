@@ -0,0 +1,17 @@
+-- One row per uploaded territory file, with the full import report.
+CREATE TABLE IF NOT EXISTS imports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    filename TEXT NOT NULL,
+    format TEXT NOT NULL, -- 'kml', 'kmz'
+    source TEXT,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    status TEXT NOT NULL, -- 'completed', 'failed'
+    added INTEGER NOT NULL DEFAULT 0,
+    updated INTEGER NOT NULL DEFAULT 0,
+    unchanged INTEGER NOT NULL DEFAULT 0,
+    retired INTEGER NOT NULL DEFAULT 0,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    report TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+-- Team rosters imported from spreadsheets, as a "; " separated list of names.
+ALTER TABLE teams ADD COLUMN members TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS locations_rtree_delete;
+DROP TRIGGER IF EXISTS locations_rtree_update;
+DROP TRIGGER IF EXISTS locations_rtree_insert;
+DROP TABLE IF EXISTS location_rtree;
@@ -0,0 +1,52 @@
+-- Spatial index over the bounding box of each location's geometry. The
+-- triggers keep it in sync with locations, so nothing that writes locations
+-- needs to know about it. The box is read from the GeoJSON with json_tree:
+-- every numeric leaf with key 0 is a longitude and key 1 a latitude.
+-- Locations without stored geometry are indexed at their point.
+CREATE VIRTUAL TABLE IF NOT EXISTS location_rtree USING rtree(
+    id,
+    min_lon, max_lon,
+    min_lat, max_lat
+);
+
+CREATE TRIGGER IF NOT EXISTS locations_rtree_insert AFTER INSERT ON locations
+BEGIN
+    INSERT INTO location_rtree (id, min_lon, max_lon, min_lat, max_lat)
+    SELECT NEW.id,
+        COALESCE(MIN(CASE WHEN key = 0 THEN value END), NEW.longitude),
+        COALESCE(MAX(CASE WHEN key = 0 THEN value END), NEW.longitude),
+        COALESCE(MIN(CASE WHEN key = 1 THEN value END), NEW.latitude),
+        COALESCE(MAX(CASE WHEN key = 1 THEN value END), NEW.latitude)
+    FROM (SELECT key, value FROM json_tree(COALESCE(NEW.geometry, '{}'))
+          WHERE type IN ('integer', 'real'));
+END;
+
+CREATE TRIGGER IF NOT EXISTS locations_rtree_update
+AFTER UPDATE OF geometry, latitude, longitude ON locations
+BEGIN
+    DELETE FROM location_rtree WHERE id = OLD.id;
+    INSERT INTO location_rtree (id, min_lon, max_lon, min_lat, max_lat)
+    SELECT NEW.id,
+        COALESCE(MIN(CASE WHEN key = 0 THEN value END), NEW.longitude),
+        COALESCE(MAX(CASE WHEN key = 0 THEN value END), NEW.longitude),
+        COALESCE(MIN(CASE WHEN key = 1 THEN value END), NEW.latitude),
+        COALESCE(MAX(CASE WHEN key = 1 THEN value END), NEW.latitude)
+    FROM (SELECT key, value FROM json_tree(COALESCE(NEW.geometry, '{}'))
+          WHERE type IN ('integer', 'real'));
+END;
+
+CREATE TRIGGER IF NOT EXISTS locations_rtree_delete AFTER DELETE ON locations
+BEGIN
+    DELETE FROM location_rtree WHERE id = OLD.id;
+END;
+
+-- Index the locations that already exist.
+INSERT INTO location_rtree (id, min_lon, max_lon, min_lat, max_lat)
+SELECT l.id,
+    COALESCE(MIN(CASE WHEN t.key = 0 THEN t.value END), l.longitude),
+    COALESCE(MAX(CASE WHEN t.key = 0 THEN t.value END), l.longitude),
+    COALESCE(MIN(CASE WHEN t.key = 1 THEN t.value END), l.latitude),
+    COALESCE(MAX(CASE WHEN t.key = 1 THEN t.value END), l.latitude)
+FROM locations l
+LEFT JOIN json_tree(COALESCE(l.geometry, '{}')) t ON t.type IN ('integer', 'real')
+GROUP BY l.id;
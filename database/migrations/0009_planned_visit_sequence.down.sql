@@ -0,0 +1 @@
+ALTER TABLE planned_visits DROP COLUMN sequence;
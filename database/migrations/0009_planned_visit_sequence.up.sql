@@ -0,0 +1,2 @@
+-- Visiting order chosen by the route planner; NULL until a route is planned.
+ALTER TABLE planned_visits ADD COLUMN sequence INTEGER;
@@ -0,0 +1,3 @@
+ALTER TABLE locations DROP COLUMN door_count;
+ALTER TABLE locations DROP COLUMN perimeter_m;
+ALTER TABLE locations DROP COLUMN area_m2;
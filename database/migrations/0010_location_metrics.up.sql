@@ -0,0 +1,6 @@
+-- Size of each location. area_m2 and perimeter_m are computed from the
+-- geometry when it is imported; NULL means they haven't been computed yet.
+-- door_count is an estimate entered by coordinators.
+ALTER TABLE locations ADD COLUMN area_m2 REAL;
+ALTER TABLE locations ADD COLUMN perimeter_m REAL;
+ALTER TABLE locations ADD COLUMN door_count INTEGER;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_location_visits_location;
+DROP INDEX IF EXISTS idx_location_lineage_child;
+DROP TABLE IF EXISTS location_lineage;
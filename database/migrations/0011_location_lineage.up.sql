@@ -0,0 +1,19 @@
+-- Which locations were split or merged into which. A split gives a row per
+-- part, all with the same parent; a merge a row per merged location, all
+-- with the same child. The parents are retired.
+CREATE TABLE IF NOT EXISTS location_lineage (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parent_id INTEGER NOT NULL,
+    child_id INTEGER NOT NULL,
+    operation TEXT NOT NULL, -- 'split', 'merge'
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(parent_id) REFERENCES locations(id),
+    FOREIGN KEY(child_id) REFERENCES locations(id),
+    UNIQUE(parent_id, child_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_location_lineage_child ON location_lineage(child_id);
+
+-- Splits and merges leave visits where they were recorded; a location reads
+-- its visits by the ids of its lineage.
+CREATE INDEX IF NOT EXISTS idx_location_visits_location ON location_visits(location_id);
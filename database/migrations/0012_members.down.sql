@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_team_memberships_member_leads;
+DROP INDEX IF EXISTS idx_team_memberships_team_leader;
+DROP INDEX IF EXISTS idx_team_memberships_current;
+DROP INDEX IF EXISTS idx_team_memberships_team;
+DROP TABLE IF EXISTS team_memberships;
+DROP TABLE IF EXISTS members;
@@ -0,0 +1,70 @@
+-- People, and the teams they belong to. A membership is ended by setting
+-- left_at rather than deleted, so past rosters are kept. The team leader is
+-- the member with a current 'leader' membership; teams.leader and
+-- teams.members are no longer read.
+CREATE TABLE IF NOT EXISTS members (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    phone TEXT NOT NULL DEFAULT '',
+    email TEXT NOT NULL DEFAULT '',
+    language TEXT NOT NULL DEFAULT '',
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS team_memberships (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    team_id INTEGER NOT NULL,
+    member_id INTEGER NOT NULL,
+    role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('leader', 'assistant', 'member')),
+    joined_at DATE NOT NULL DEFAULT CURRENT_DATE,
+    left_at DATE,
+    FOREIGN KEY(team_id) REFERENCES teams(id),
+    FOREIGN KEY(member_id) REFERENCES members(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_team_memberships_team ON team_memberships(team_id);
+
+-- One current membership per person and team.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_team_memberships_current
+ON team_memberships(team_id, member_id) WHERE left_at IS NULL;
+
+-- A team has one leader at a time, and a person leads one team at a time.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_team_memberships_team_leader
+ON team_memberships(team_id) WHERE role = 'leader' AND left_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_team_memberships_member_leads
+ON team_memberships(member_id) WHERE role = 'leader' AND left_at IS NULL;
+
+-- Move the existing rosters over, one member per distinct name. Someone
+-- listed as leader of several teams leads the first and assists the rest.
+CREATE TEMP TABLE roster (team_id INTEGER, name TEXT, is_leader BOOLEAN);
+
+INSERT INTO roster (team_id, name, is_leader)
+SELECT id, TRIM(leader), TRUE FROM teams WHERE TRIM(leader) != '';
+
+INSERT INTO roster (team_id, name, is_leader)
+WITH RECURSIVE split(team_id, name, rest) AS (
+    SELECT id, '', members || ';' FROM teams
+    UNION ALL
+    SELECT team_id, TRIM(substr(rest, 1, instr(rest, ';') - 1)), substr(rest, instr(rest, ';') + 1)
+    FROM split WHERE rest != ''
+)
+SELECT team_id, name, FALSE FROM split WHERE name != '';
+
+INSERT INTO members (name)
+SELECT name FROM roster GROUP BY name COLLATE NOCASE ORDER BY MIN(rowid);
+
+INSERT INTO team_memberships (team_id, member_id, role)
+SELECT r.team_id, m.id,
+    CASE
+        WHEN NOT MAX(r.is_leader) THEN 'member'
+        WHEN r.team_id = (SELECT MIN(team_id) FROM roster
+                          WHERE is_leader AND name = m.name COLLATE NOCASE) THEN 'leader'
+        ELSE 'assistant'
+    END
+FROM roster r
+JOIN members m ON m.name = r.name COLLATE NOCASE
+GROUP BY r.team_id, m.id
+ORDER BY r.team_id, MIN(r.rowid);
+
+DROP TABLE roster;
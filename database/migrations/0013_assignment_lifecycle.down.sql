@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_assignment_events_assignment;
+DROP TABLE IF EXISTS assignment_events;
+DROP TABLE IF EXISTS settings;
+DROP INDEX IF EXISTS idx_team_assignments_status;
+ALTER TABLE team_assignments DROP COLUMN returned_date;
+ALTER TABLE team_assignments DROP COLUMN due_date;
+ALTER TABLE team_assignments DROP COLUMN status;
@@ -0,0 +1,49 @@
+-- Assignments move through a checkout lifecycle: checked_out and
+-- in_progress are open; returned, completed and reassigned are closed.
+-- is_completed is kept in step for older readers and is true only for
+-- completed. due_date is when the team should bring the territory back.
+ALTER TABLE team_assignments ADD COLUMN status TEXT NOT NULL DEFAULT 'checked_out'
+    CHECK (status IN ('checked_out', 'in_progress', 'returned', 'completed', 'reassigned'));
+ALTER TABLE team_assignments ADD COLUMN due_date DATE;
+ALTER TABLE team_assignments ADD COLUMN returned_date DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_team_assignments_status ON team_assignments(status, due_date);
+
+-- Application settings, one value per key.
+CREATE TABLE IF NOT EXISTS settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Territories are lent for four months unless changed.
+INSERT OR IGNORE INTO settings (key, value) VALUES ('assignment_loan_days', '120');
+
+-- Every change of an assignment's status. from_status is NULL when the
+-- assignment is created.
+CREATE TABLE IF NOT EXISTS assignment_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    assignment_id INTEGER NOT NULL,
+    team_id INTEGER NOT NULL,
+    location_id INTEGER NOT NULL,
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_assignment_events_assignment ON assignment_events(assignment_id);
+
+UPDATE team_assignments
+SET status = CASE WHEN is_completed THEN 'completed' ELSE 'checked_out' END,
+    due_date = CASE WHEN is_completed THEN NULL
+                    ELSE DATE(assigned_date, '+120 days') END;
+
+INSERT INTO assignment_events (assignment_id, team_id, location_id, from_status, to_status, note, created_at)
+SELECT id, team_id, location_id, NULL, 'checked_out', 'recorded before assignment tracking', assigned_date
+FROM team_assignments;
+
+INSERT INTO assignment_events (assignment_id, team_id, location_id, from_status, to_status, note, created_at)
+SELECT id, team_id, location_id, 'checked_out', 'completed', 'recorded before assignment tracking',
+       COALESCE(completed_date, assigned_date)
+FROM team_assignments WHERE status = 'completed';
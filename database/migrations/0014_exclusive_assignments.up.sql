@@ -0,0 +1,25 @@
+-- A location is checked out to at most one team at a time. Where several
+-- teams hold the same location open, the most recent checkout keeps it and
+-- the others are closed as reassigned.
+CREATE TEMP TABLE superseded AS
+SELECT id, team_id, location_id, status
+FROM (
+    SELECT id, team_id, location_id, status,
+           ROW_NUMBER() OVER (PARTITION BY location_id ORDER BY assigned_date DESC, id DESC) as rn
+    FROM team_assignments
+    WHERE status IN ('checked_out', 'in_progress')
+)
+WHERE rn > 1;
+
+INSERT INTO assignment_events (assignment_id, team_id, location_id, from_status, to_status, note)
+SELECT id, team_id, location_id, status, 'reassigned', 'held by another team when assignments became exclusive'
+FROM superseded ORDER BY id;
+
+UPDATE team_assignments
+SET status = 'reassigned', is_completed = FALSE, returned_date = CURRENT_TIMESTAMP
+WHERE id IN (SELECT id FROM superseded);
+
+DROP TABLE superseded;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_team_assignments_open_location
+    ON team_assignments(location_id) WHERE status IN ('checked_out', 'in_progress');
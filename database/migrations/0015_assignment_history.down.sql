@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS assignment_events_no_delete;
+DROP TRIGGER IF EXISTS assignment_events_no_update;
+DROP INDEX IF EXISTS idx_assignment_events_team;
+DROP INDEX IF EXISTS idx_assignment_events_location;
+ALTER TABLE assignment_events DROP COLUMN location_name;
+ALTER TABLE assignment_events DROP COLUMN team_name;
+ALTER TABLE assignment_events DROP COLUMN actor;
+ALTER TABLE assignment_events DROP COLUMN action;
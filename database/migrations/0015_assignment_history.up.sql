@@ -0,0 +1,34 @@
+-- assignment_events becomes the permanent history of who worked each
+-- territory. Each event keeps the team and location names it was recorded
+-- with, so it stays readable after the team or the assignment is deleted,
+-- says what happened in action, and who did it in actor.
+ALTER TABLE assignment_events ADD COLUMN action TEXT NOT NULL DEFAULT '';
+ALTER TABLE assignment_events ADD COLUMN actor TEXT NOT NULL DEFAULT '';
+ALTER TABLE assignment_events ADD COLUMN team_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE assignment_events ADD COLUMN location_name TEXT NOT NULL DEFAULT '';
+
+UPDATE assignment_events SET
+    action = CASE
+        WHEN note LIKE 'split from %' OR note LIKE 'merged from %' THEN 'inherited'
+        WHEN to_status = 'reassigned' AND note LIKE 'location %' THEN 'replaced'
+        WHEN to_status = 'checked_out' THEN 'assigned'
+        WHEN to_status = 'in_progress' THEN 'started'
+        WHEN to_status = 'reassigned' THEN 'transferred'
+        ELSE to_status END,
+    team_name = COALESCE((SELECT name FROM teams WHERE teams.id = assignment_events.team_id), ''),
+    location_name = COALESCE((SELECT name FROM locations WHERE locations.id = assignment_events.location_id), '');
+
+CREATE INDEX IF NOT EXISTS idx_assignment_events_location ON assignment_events(location_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_assignment_events_team ON assignment_events(team_id, created_at);
+
+CREATE TRIGGER IF NOT EXISTS assignment_events_no_update
+BEFORE UPDATE ON assignment_events
+BEGIN
+    SELECT RAISE(ABORT, 'assignment history is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS assignment_events_no_delete
+BEFORE DELETE ON assignment_events
+BEGIN
+    SELECT RAISE(ABORT, 'assignment history is append-only');
+END;
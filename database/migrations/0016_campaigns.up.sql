@@ -0,0 +1,24 @@
+-- Campaigns are coverage cycles: a location counts as preached within a
+-- cycle when it has a preached visit between the cycle's start and end
+-- dates. Cycles don't overlap; the current one is the latest to have
+-- started. A cycle with no end date runs until the next is opened.
+CREATE TABLE IF NOT EXISTS campaigns (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    start_date DATE NOT NULL UNIQUE,
+    end_date DATE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    CHECK (end_date IS NULL OR end_date >= start_date)
+);
+
+-- Everything recorded so far belongs to a first cycle. Campaign dates are
+-- local, as the server computes them.
+INSERT INTO campaigns (name, start_date)
+SELECT 'Initial coverage', COALESCE(MIN(DATE(visit_date, 'localtime')), DATE('now', 'localtime'))
+FROM location_visits;
+
+-- locations.is_preached now means preached in the current cycle.
+UPDATE locations SET is_preached = EXISTS (
+    SELECT 1 FROM location_visits v
+    WHERE v.location_id = locations.id AND v.is_preached = TRUE
+);
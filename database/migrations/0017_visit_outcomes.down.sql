@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_location_visit_outcomes_outcome;
+DROP TABLE IF EXISTS location_visit_outcomes;
+DROP TABLE IF EXISTS visit_outcomes;
@@ -0,0 +1,44 @@
+-- The outcomes a visit can record, such as doors knocked or nobody home.
+-- A visit preaches its location when it records a positive count of an
+-- outcome that counts_as_preached. Outcomes in use are deactivated rather
+-- than deleted.
+CREATE TABLE IF NOT EXISTS visit_outcomes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL UNIQUE,
+    label TEXT NOT NULL,
+    counts_as_preached BOOLEAN NOT NULL DEFAULT FALSE,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Only preached covers the whole territory. Counts such as doors knocked
+-- are recorded on partial visits too, so they don't preach it.
+INSERT OR IGNORE INTO visit_outcomes (code, label, counts_as_preached, sort_order) VALUES
+    ('preached', 'Territory preached', TRUE, 10),
+    ('partially_covered', 'Partially covered', FALSE, 20),
+    ('doors_knocked', 'Doors knocked', FALSE, 30),
+    ('conversations', 'Conversations held', FALSE, 40),
+    ('literature_left', 'Literature left', FALSE, 50),
+    ('return_visit_requested', 'Return visit requested', FALSE, 60),
+    ('nobody_home', 'Nobody home', FALSE, 70),
+    ('inaccessible', 'Area inaccessible', FALSE, 80);
+
+-- How many of each outcome a visit recorded.
+CREATE TABLE IF NOT EXISTS location_visit_outcomes (
+    visit_id INTEGER NOT NULL,
+    outcome_id INTEGER NOT NULL,
+    count INTEGER NOT NULL DEFAULT 1 CHECK (count >= 0),
+    PRIMARY KEY (visit_id, outcome_id),
+    FOREIGN KEY(visit_id) REFERENCES location_visits(id),
+    FOREIGN KEY(outcome_id) REFERENCES visit_outcomes(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_location_visit_outcomes_outcome ON location_visit_outcomes(outcome_id);
+
+-- Visits recorded as preached before outcomes existed preached the
+-- territory.
+INSERT OR IGNORE INTO location_visit_outcomes (visit_id, outcome_id, count)
+SELECT v.id, o.id, 1
+FROM location_visits v, visit_outcomes o
+WHERE v.is_preached = TRUE AND o.code = 'preached';
@@ -0,0 +1,165 @@
+package geo
+
+import (
+	"math"
+	"sort"
+)
+
+// maxClusterIterations bounds the k-means refinement; it normally settles in
+// a handful of rounds.
+const maxClusterIterations = 50
+
+// BalancedClusters splits points into k geographically compact groups whose
+// total weights are as even as possible, and returns the group of each
+// point. It is k-means with a capacity on each group: points are placed in
+// order of how much they would lose by not getting their nearest centre, so
+// the points with a clear home are placed first and the ones on a boundary
+// go wherever there is room. No group carries more than an even share of
+// the total weight plus the heaviest point. Starting centres are chosen by
+// farthest-point sampling, so the same input always gives the same groups.
+func BalancedClusters(points []Position, weights []float64, k int) []int {
+	n := len(points)
+	if k <= 0 || n == 0 {
+		return nil
+	}
+	if k > n {
+		k = n
+	}
+
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	// Allow a little slack so a single heavy point doesn't force a far away
+	// neighbour into another group.
+	capacity := total / float64(k)
+	maxWeight := 0.0
+	for _, w := range weights {
+		maxWeight = math.Max(maxWeight, w)
+	}
+	capacity += maxWeight / 2
+
+	centers := farthestPoints(points, k)
+	groups := make([]int, n)
+	for iter := 0; iter < maxClusterIterations; iter++ {
+		next := assignWithCapacity(points, weights, centers, capacity)
+		changed := iter == 0
+		for i := range next {
+			if next[i] != groups[i] {
+				changed = true
+			}
+		}
+		groups = next
+		if !changed {
+			break
+		}
+		centers = groupCenters(points, weights, groups, centers)
+	}
+	return groups
+}
+
+// farthestPoints picks k starting centres: the point nearest the middle of
+// all points, then repeatedly the point farthest from those already picked.
+func farthestPoints(points []Position, k int) []Position {
+	middle := mean(points)
+	first := 0
+	for i, p := range points {
+		if Distance(p, middle) < Distance(points[first], middle) {
+			first = i
+		}
+	}
+
+	centers := []Position{points[first]}
+	nearest := make([]float64, len(points))
+	for i, p := range points {
+		nearest[i] = Distance(p, points[first])
+	}
+	for len(centers) < k {
+		far := 0
+		for i := range points {
+			if nearest[i] > nearest[far] {
+				far = i
+			}
+		}
+		centers = append(centers, points[far])
+		for i, p := range points {
+			nearest[i] = math.Min(nearest[i], Distance(p, points[far]))
+		}
+	}
+	return centers
+}
+
+// assignWithCapacity gives each point the nearest centre with room for it.
+// A point that fits nowhere goes to the least loaded group, which has at
+// most an even share of the weight placed so far.
+func assignWithCapacity(points []Position, weights []float64, centers []Position, capacity float64) []int {
+	type choice struct {
+		point  int
+		order  []int // centres, nearest first
+		regret float64
+	}
+
+	choices := make([]choice, len(points))
+	for i, p := range points {
+		dist := make([]float64, len(centers))
+		order := make([]int, len(centers))
+		for c, center := range centers {
+			dist[c] = Distance(p, center)
+			order[c] = c
+		}
+		sort.SliceStable(order, func(a, b int) bool { return dist[order[a]] < dist[order[b]] })
+
+		regret := 0.0
+		if len(order) > 1 {
+			regret = dist[order[1]] - dist[order[0]]
+		}
+		choices[i] = choice{point: i, order: order, regret: regret}
+	}
+	sort.SliceStable(choices, func(a, b int) bool { return choices[a].regret > choices[b].regret })
+
+	load := make([]float64, len(centers))
+	groups := make([]int, len(points))
+	for _, ch := range choices {
+		w := weights[ch.point]
+		group := -1
+		for _, c := range ch.order {
+			if load[c]+w <= capacity {
+				group = c
+				break
+			}
+		}
+		if group < 0 {
+			group = ch.order[0]
+			for _, c := range ch.order {
+				if load[c] < load[group] {
+					group = c
+				}
+			}
+		}
+		groups[ch.point] = group
+		load[group] += w
+	}
+	return groups
+}
+
+func groupCenters(points []Position, weights []float64, groups []int, previous []Position) []Position {
+	sums := make([]Position, len(previous))
+	totals := make([]float64, len(previous))
+	for i, p := range points {
+		// Weightless points still pull their centre a little.
+		w := math.Max(weights[i], 1e-9)
+		sums[groups[i]][0] += p[0] * w
+		sums[groups[i]][1] += p[1] * w
+		totals[groups[i]] += w
+	}
+
+	centers := make([]Position, len(previous))
+	for c := range centers {
+		if totals[c] == 0 {
+			centers[c] = previous[c]
+			continue
+		}
+		centers[c] = Position{sums[c][0] / totals[c], sums[c][1] / totals[c]}
+	}
+	return centers
+}
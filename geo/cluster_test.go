@@ -0,0 +1,150 @@
+package geo
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// scatter returns n positions spread over about a kilometre around center,
+// the same ones for the same seed.
+func scatter(seed int64, n int, center Position) []Position {
+	r := rand.New(rand.NewSource(seed))
+	points := make([]Position, n)
+	for i := range points {
+		points[i] = Position{center[0] + r.Float64()*0.01, center[1] + r.Float64()*0.01}
+	}
+	return points
+}
+
+func ones(n int) []float64 {
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return weights
+}
+
+func TestBalancedClustersCapacity(t *testing.T) {
+	skewed := func(seed int64, n int) []float64 {
+		r := rand.New(rand.NewSource(seed))
+		weights := make([]float64, n)
+		for i := range weights {
+			weights[i] = 1 + r.ExpFloat64()*20000
+		}
+		return weights
+	}
+
+	tests := []struct {
+		name    string
+		points  []Position
+		weights []float64
+		k       int
+	}{
+		{"even count", scatter(1, 40, Position{-76.3, 36.8}), ones(40), 4},
+		{"uneven count", scatter(2, 9, Position{-76.3, 36.8}), ones(9), 4},
+		{"one per group", scatter(3, 5, Position{0, 0}), ones(5), 5},
+		{"shares that don't divide evenly", scatter(300, 14, Position{0, 0}), ones(14), 6},
+		{"shares that don't divide evenly, more points", scatter(112, 32, Position{0, 0}), ones(32), 5},
+		{"skewed areas", scatter(4, 60, Position{10, 50}), skewed(4, 60), 6},
+		{"skewed areas, many groups", scatter(5, 200, Position{-76.3, 36.8}), skewed(5, 200), 17},
+		{"one heavy territory", scatter(6, 20, Position{0, 0}), append(ones(19), 50), 3},
+		{
+			name:    "crowded corner",
+			points:  append(scatter(7, 30, Position{0, 0}), scatter(8, 3, Position{0.5, 0.5})...),
+			weights: ones(33),
+			k:       3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := BalancedClusters(tt.points, tt.weights, tt.k)
+			if len(groups) != len(tt.points) {
+				t.Fatalf("got %d groups for %d points", len(groups), len(tt.points))
+			}
+
+			var total, heaviest float64
+			for _, w := range tt.weights {
+				total += w
+				heaviest = math.Max(heaviest, w)
+			}
+			load := make([]float64, tt.k)
+			for i, g := range groups {
+				if g < 0 || g >= tt.k {
+					t.Fatalf("point %d is in group %d, want 0 to %d", i, g, tt.k-1)
+				}
+				load[g] += tt.weights[i]
+			}
+			// A group is filled to an even share plus at most one more
+			// territory.
+			for g, l := range load {
+				if bound := total/float64(tt.k) + heaviest; l > bound+1e-9 {
+					t.Errorf("group %d carries %.1f, over the bound of %.1f", g, l, bound)
+				}
+				if l == 0 {
+					t.Errorf("group %d is empty", g)
+				}
+			}
+
+			if again := BalancedClusters(tt.points, tt.weights, tt.k); !reflect.DeepEqual(groups, again) {
+				t.Errorf("a second run gave different groups")
+			}
+		})
+	}
+}
+
+func TestBalancedClustersKeepsNeighboursTogether(t *testing.T) {
+	// Two towns twenty kilometres apart, each with ten territories.
+	west := scatter(1, 10, Position{-76.5, 36.8})
+	east := scatter(2, 10, Position{-76.3, 36.8})
+	groups := BalancedClusters(append(west, east...), ones(20), 2)
+
+	for i := 1; i < 10; i++ {
+		if groups[i] != groups[0] {
+			t.Errorf("west territory %d is in group %d, want %d with the rest of the west", i, groups[i], groups[0])
+		}
+		if groups[10+i] != groups[10] {
+			t.Errorf("east territory %d is in group %d, want %d with the rest of the east", i, groups[10+i], groups[10])
+		}
+	}
+	if groups[0] == groups[10] {
+		t.Errorf("both towns are in group %d", groups[0])
+	}
+}
+
+func TestBalancedClustersEdgeCases(t *testing.T) {
+	points := scatter(1, 3, Position{0, 0})
+
+	tests := []struct {
+		name   string
+		points []Position
+		k      int
+		want   int // distinct groups; -1 for no result
+	}{
+		{"no points", nil, 3, -1},
+		{"no groups", points, 0, -1},
+		{"more groups than points", points, 5, 3},
+		{"one group", points, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := BalancedClusters(tt.points, ones(len(tt.points)), tt.k)
+			if tt.want < 0 {
+				if groups != nil {
+					t.Errorf("got %v, want nil", groups)
+				}
+				return
+			}
+			distinct := make(map[int]bool)
+			for _, g := range groups {
+				distinct[g] = true
+			}
+			if len(groups) != len(tt.points) || len(distinct) != tt.want {
+				t.Errorf("got groups %v, want %d points in %d groups", groups, len(tt.points), tt.want)
+			}
+		})
+	}
+}
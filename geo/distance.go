@@ -0,0 +1,190 @@
+package geo
+
+import "math"
+
+// EarthRadius is the mean radius of the earth in metres.
+const EarthRadius = 6371008.8
+
+// Distance returns the great-circle distance in metres between two
+// positions, using the haversine formula.
+func Distance(a, b Position) float64 {
+	lat1, lat2 := radians(a.Lat()), radians(b.Lat())
+	dLat := lat2 - lat1
+	dLon := radians(b.Lon() - a.Lon())
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// BoundsAround returns the longitude and latitude box that contains every
+// point within radius metres of center.
+func BoundsAround(center Position, radius float64) (minLon, minLat, maxLon, maxLat float64) {
+	dLat := degrees(radius / EarthRadius)
+	// Near the poles the longitude span grows without bound; use the whole
+	// range rather than dividing by a cosine close to zero.
+	dLon := 180.0
+	if c := math.Cos(radians(center.Lat())); c > 1e-6 {
+		dLon = math.Min(180, dLat/c)
+	}
+	return center.Lon() - dLon, center.Lat() - dLat, center.Lon() + dLon, center.Lat() + dLat
+}
+
+// Contains reports whether the position lies inside the polygon and outside
+// its holes. Points exactly on an edge may fall either way.
+func (p Polygon) Contains(pos Position) bool {
+	if len(p) == 0 || !p[0].contains(pos) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if hole.contains(pos) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains is the even-odd ray casting test.
+func (r Ring) contains(pos Position) bool {
+	inside := false
+	x, y := pos.Lon(), pos.Lat()
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		xi, yi := r[i].Lon(), r[i].Lat()
+		xj, yj := r[j].Lon(), r[j].Lat()
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Contains reports whether the position lies inside any polygon of the
+// geometry. Points and lines contain nothing.
+func (g Geometry) Contains(pos Position) bool {
+	for _, p := range g.Polygons() {
+		if p.Contains(pos) {
+			return true
+		}
+	}
+	return false
+}
+
+// DistanceTo returns the distance in metres from the position to the nearest
+// part of the geometry, or 0 if the position is inside one of its polygons.
+// Distances to edges use a flat projection centred on the position, which is
+// accurate for the few kilometres a territory search covers.
+func (g Geometry) DistanceTo(pos Position) float64 {
+	if g.Contains(pos) {
+		return 0
+	}
+
+	best := math.Inf(1)
+	for _, p := range g.Points() {
+		best = math.Min(best, Distance(pos, p))
+	}
+
+	proj := newProjection(pos)
+	edges := func(line []Position) {
+		for i := 0; i+1 < len(line); i++ {
+			best = math.Min(best, proj.segmentDistance(line[i], line[i+1]))
+		}
+		if len(line) == 1 {
+			best = math.Min(best, Distance(pos, line[0]))
+		}
+	}
+	for _, line := range g.Lines() {
+		edges(line)
+	}
+	for _, p := range g.Polygons() {
+		for _, ring := range p {
+			edges(ring)
+		}
+	}
+	return best
+}
+
+// projection maps positions to metres east and north of an origin.
+type projection struct {
+	origin Position
+	kx, ky float64
+}
+
+func newProjection(origin Position) projection {
+	ky := radians(EarthRadius)
+	return projection{origin: origin, kx: ky * math.Cos(radians(origin.Lat())), ky: ky}
+}
+
+func (p projection) xy(pos Position) (float64, float64) {
+	return (pos.Lon() - p.origin.Lon()) * p.kx, (pos.Lat() - p.origin.Lat()) * p.ky
+}
+
+// segmentDistance is the distance from the origin to the segment a-b.
+func (p projection) segmentDistance(a, b Position) float64 {
+	ax, ay := p.xy(a)
+	bx, by := p.xy(b)
+	dx, dy := bx-ax, by-ay
+
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
+
+func radians(deg float64) float64 { return deg * math.Pi / 180 }
+func degrees(rad float64) float64 { return rad * 180 / math.Pi }
+
+// Area returns the geodesic area of the geometry's polygons in square
+// metres, with holes subtracted, treating the earth as a sphere.
+func (g Geometry) Area() float64 {
+	var total float64
+	for _, p := range g.Polygons() {
+		for i, ring := range p {
+			a := ring.sphericalArea()
+			if i > 0 {
+				a = -a
+			}
+			total += a
+		}
+	}
+	return math.Max(0, total)
+}
+
+// Perimeter returns the length in metres of the geometry's polygon
+// boundaries, holes included, plus the length of its lines.
+func (g Geometry) Perimeter() float64 {
+	var total float64
+	for _, p := range g.Polygons() {
+		for _, ring := range p {
+			total += pathLength(ring)
+		}
+	}
+	for _, line := range g.Lines() {
+		total += pathLength(line)
+	}
+	return total
+}
+
+// sphericalArea is the area enclosed by the ring on a sphere, from
+// Chamberlain and Duquette, "Some Algorithms for Polygons on a Sphere".
+func (r Ring) sphericalArea() float64 {
+	pts := openRing(r)
+	n := len(pts)
+	if n < 3 {
+		return 0
+	}
+
+	var total float64
+	for i := range pts {
+		prev, next := pts[(i+n-1)%n], pts[(i+1)%n]
+		total += radians(next.Lon()-prev.Lon()) * math.Sin(radians(pts[i].Lat()))
+	}
+	return math.Abs(total * EarthRadius * EarthRadius / 2)
+}
+
+func pathLength(line []Position) float64 {
+	var total float64
+	for i := 0; i+1 < len(line); i++ {
+		total += Distance(line[i], line[i+1])
+	}
+	return total
+}
@@ -0,0 +1,403 @@
+// Package geo holds the geometry types stored for locations and the small
+// amount of spherical and planar math the API needs on them.
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Position is a longitude/latitude pair, in the order used by KML and GeoJSON.
+type Position [2]float64
+
+func (p Position) Lon() float64 { return p[0] }
+func (p Position) Lat() float64 { return p[1] }
+
+// Ring is a closed sequence of positions; the first and last are equal.
+type Ring []Position
+
+// Polygon is an outer ring followed by zero or more inner rings (holes).
+type Polygon []Ring
+
+const (
+	TypePoint              = "Point"
+	TypeLineString         = "LineString"
+	TypePolygon            = "Polygon"
+	TypeMultiPoint         = "MultiPoint"
+	TypeMultiLineString    = "MultiLineString"
+	TypeMultiPolygon       = "MultiPolygon"
+	TypeGeometryCollection = "GeometryCollection"
+)
+
+// Geometry is a GeoJSON geometry. Only the field matching Type is set.
+type Geometry struct {
+	Type            string
+	Point           Position
+	LineString      []Position
+	Polygon         Polygon
+	MultiPoint      []Position
+	MultiLineString [][]Position
+	MultiPolygon    []Polygon
+	Geometries      []Geometry
+}
+
+func NewPoint(lon, lat float64) Geometry {
+	return Geometry{Type: TypePoint, Point: Position{lon, lat}}
+}
+
+func NewLineString(line []Position) Geometry {
+	return Geometry{Type: TypeLineString, LineString: line}
+}
+
+func NewPolygon(p Polygon) Geometry {
+	return Geometry{Type: TypePolygon, Polygon: p}
+}
+
+// Collect combines several geometries into one. A single part is returned
+// as is; parts of one kind become the matching Multi* geometry and mixed
+// parts a GeometryCollection.
+func Collect(parts []Geometry) Geometry {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+
+	kinds := make(map[string]bool)
+	for _, part := range parts {
+		kinds[part.Type] = true
+	}
+	if len(kinds) == 1 {
+		var multi Geometry
+		switch parts[0].Type {
+		case TypePoint:
+			multi.Type = TypeMultiPoint
+			for _, part := range parts {
+				multi.MultiPoint = append(multi.MultiPoint, part.Point)
+			}
+			return multi
+		case TypeLineString:
+			multi.Type = TypeMultiLineString
+			for _, part := range parts {
+				multi.MultiLineString = append(multi.MultiLineString, part.LineString)
+			}
+			return multi
+		case TypePolygon:
+			multi.Type = TypeMultiPolygon
+			for _, part := range parts {
+				multi.MultiPolygon = append(multi.MultiPolygon, part.Polygon)
+			}
+			return multi
+		}
+	}
+
+	return Geometry{Type: TypeGeometryCollection, Geometries: parts}
+}
+
+type geoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates,omitempty"`
+	Geometries  []Geometry      `json:"geometries,omitempty"`
+}
+
+func (g Geometry) MarshalJSON() ([]byte, error) {
+	var coords interface{}
+	switch g.Type {
+	case TypePoint:
+		coords = g.Point
+	case TypeLineString:
+		coords = g.LineString
+	case TypePolygon:
+		coords = g.Polygon
+	case TypeMultiPoint:
+		coords = g.MultiPoint
+	case TypeMultiLineString:
+		coords = g.MultiLineString
+	case TypeMultiPolygon:
+		coords = g.MultiPolygon
+	case TypeGeometryCollection:
+		geometries := g.Geometries
+		if geometries == nil {
+			geometries = []Geometry{}
+		}
+		return json.Marshal(geoJSONGeometry{Type: g.Type, Geometries: geometries})
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %q", g.Type)
+	}
+
+	raw, err := json.Marshal(coords)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(geoJSONGeometry{Type: g.Type, Coordinates: raw})
+}
+
+func (g *Geometry) UnmarshalJSON(data []byte) error {
+	var raw geoJSONGeometry
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*g = Geometry{Type: raw.Type}
+	switch raw.Type {
+	case TypePoint:
+		return json.Unmarshal(raw.Coordinates, &g.Point)
+	case TypeLineString:
+		return json.Unmarshal(raw.Coordinates, &g.LineString)
+	case TypePolygon:
+		return json.Unmarshal(raw.Coordinates, &g.Polygon)
+	case TypeMultiPoint:
+		return json.Unmarshal(raw.Coordinates, &g.MultiPoint)
+	case TypeMultiLineString:
+		return json.Unmarshal(raw.Coordinates, &g.MultiLineString)
+	case TypeMultiPolygon:
+		return json.Unmarshal(raw.Coordinates, &g.MultiPolygon)
+	case TypeGeometryCollection:
+		g.Geometries = raw.Geometries
+		return nil
+	default:
+		return fmt.Errorf("unsupported geometry type %q", raw.Type)
+	}
+}
+
+// Polygons returns every polygon in the geometry, including those inside
+// multi-geometries and collections.
+func (g Geometry) Polygons() []Polygon {
+	switch g.Type {
+	case TypePolygon:
+		return []Polygon{g.Polygon}
+	case TypeMultiPolygon:
+		return g.MultiPolygon
+	case TypeGeometryCollection:
+		var polygons []Polygon
+		for _, part := range g.Geometries {
+			polygons = append(polygons, part.Polygons()...)
+		}
+		return polygons
+	}
+	return nil
+}
+
+// Lines returns every line string in the geometry.
+func (g Geometry) Lines() [][]Position {
+	switch g.Type {
+	case TypeLineString:
+		return [][]Position{g.LineString}
+	case TypeMultiLineString:
+		return g.MultiLineString
+	case TypeGeometryCollection:
+		var lines [][]Position
+		for _, part := range g.Geometries {
+			lines = append(lines, part.Lines()...)
+		}
+		return lines
+	}
+	return nil
+}
+
+// Points returns every standalone point in the geometry.
+func (g Geometry) Points() []Position {
+	switch g.Type {
+	case TypePoint:
+		return []Position{g.Point}
+	case TypeMultiPoint:
+		return g.MultiPoint
+	case TypeGeometryCollection:
+		var points []Position
+		for _, part := range g.Geometries {
+			points = append(points, part.Points()...)
+		}
+		return points
+	}
+	return nil
+}
+
+// Centroid returns the representative point of the geometry. As in most GIS
+// tools only the highest dimension present counts: the area-weighted centroid
+// of its polygons, else the length-weighted centroid of its lines, else the
+// mean of its points.
+func (g Geometry) Centroid() Position {
+	var area, cx, cy float64
+	for _, p := range g.Polygons() {
+		a, x, y := p.moments()
+		area += a
+		cx += x
+		cy += y
+	}
+	if area != 0 {
+		return Position{cx / (3 * area), cy / (3 * area)}
+	}
+
+	var length float64
+	cx, cy = 0, 0
+	for _, line := range g.Lines() {
+		for i := 0; i+1 < len(line); i++ {
+			d := math.Hypot(line[i+1][0]-line[i][0], line[i+1][1]-line[i][1])
+			length += d
+			cx += d * (line[i][0] + line[i+1][0]) / 2
+			cy += d * (line[i][1] + line[i+1][1]) / 2
+		}
+	}
+	if length != 0 {
+		return Position{cx / length, cy / length}
+	}
+
+	// Degenerate polygons and lines fall back to the mean of their vertices.
+	points := g.Points()
+	for _, p := range g.Polygons() {
+		if len(p) > 0 {
+			points = append(points, openRing(p[0])...)
+		}
+	}
+	for _, line := range g.Lines() {
+		points = append(points, line...)
+	}
+	return mean(points)
+}
+
+// Centroid returns the area-weighted centroid of the polygon with its holes
+// subtracted. Territories are small enough that treating longitude and
+// latitude as planar coordinates is accurate to well under a metre.
+func (p Polygon) Centroid() Position {
+	area, cx, cy := p.moments()
+	if area == 0 {
+		if len(p) == 0 {
+			return Position{}
+		}
+		return mean(openRing(p[0]))
+	}
+	return Position{cx / (3 * area), cy / (3 * area)}
+}
+
+// moments sums the ring moments with the outer ring counted positive and
+// holes negative, regardless of their winding order.
+func (p Polygon) moments() (area, mx, my float64) {
+	for i, ring := range p {
+		a, x, y := ring.moments()
+		if (i == 0) != (a > 0) {
+			a, x, y = -a, -x, -y
+		}
+		area += a
+		mx += x
+		my += y
+	}
+	return area, mx, my
+}
+
+// moments returns the signed area of the ring and its first moments, using
+// the shoelace formula.
+func (r Ring) moments() (area, mx, my float64) {
+	for i := 0; i+1 < len(r); i++ {
+		x0, y0 := r[i][0], r[i][1]
+		x1, y1 := r[i+1][0], r[i+1][1]
+		cross := x0*y1 - x1*y0
+		area += cross
+		mx += (x0 + x1) * cross
+		my += (y0 + y1) * cross
+	}
+	return area / 2, mx / 2, my / 2
+}
+
+// openRing drops the closing vertex so it isn't counted twice.
+func openRing(r Ring) []Position {
+	if n := len(r); n > 1 && r[0] == r[n-1] {
+		return r[:n-1]
+	}
+	return r
+}
+
+func mean(points []Position) Position {
+	if len(points) == 0 {
+		return Position{}
+	}
+
+	var sum Position
+	for _, pos := range points {
+		sum[0] += pos[0]
+		sum[1] += pos[1]
+	}
+	return Position{sum[0] / float64(len(points)), sum[1] / float64(len(points))}
+}
+
+// Validate reports the first problem that would make the geometry unusable
+// as a territory: coordinates out of range, lines with fewer than two
+// positions, or rings that are too short or not closed.
+func (g Geometry) Validate() error {
+	switch g.Type {
+	case TypePoint:
+		return validatePositions([]Position{g.Point})
+	case TypeMultiPoint:
+		if len(g.MultiPoint) == 0 {
+			return fmt.Errorf("multipoint has no points")
+		}
+		return validatePositions(g.MultiPoint)
+	case TypeLineString:
+		return validateLine(g.LineString)
+	case TypeMultiLineString:
+		if len(g.MultiLineString) == 0 {
+			return fmt.Errorf("multilinestring has no lines")
+		}
+		for _, line := range g.MultiLineString {
+			if err := validateLine(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	case TypePolygon:
+		return g.Polygon.validate()
+	case TypeMultiPolygon:
+		if len(g.MultiPolygon) == 0 {
+			return fmt.Errorf("multipolygon has no polygons")
+		}
+		for _, p := range g.MultiPolygon {
+			if err := p.validate(); err != nil {
+				return err
+			}
+		}
+		return nil
+	case TypeGeometryCollection:
+		if len(g.Geometries) == 0 {
+			return fmt.Errorf("geometry collection is empty")
+		}
+		for _, part := range g.Geometries {
+			if err := part.Validate(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported geometry type %q", g.Type)
+}
+
+func (p Polygon) validate() error {
+	if len(p) == 0 {
+		return fmt.Errorf("polygon has no rings")
+	}
+	for _, ring := range p {
+		if len(ring) < 4 {
+			return fmt.Errorf("ring has %d positions, need at least 4", len(ring))
+		}
+		if ring[0] != ring[len(ring)-1] {
+			return fmt.Errorf("ring is not closed")
+		}
+		if err := validatePositions(ring); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateLine(line []Position) error {
+	if len(line) < 2 {
+		return fmt.Errorf("line has %d positions, need at least 2", len(line))
+	}
+	return validatePositions(line)
+}
+
+func validatePositions(positions []Position) error {
+	for _, pos := range positions {
+		if math.IsNaN(pos[0]) || math.IsNaN(pos[1]) || math.Abs(pos[0]) > 180 || math.Abs(pos[1]) > 90 {
+			return fmt.Errorf("position %v is out of range", pos)
+		}
+	}
+	return nil
+}
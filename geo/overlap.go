@@ -0,0 +1,109 @@
+package geo
+
+import "math"
+
+// overlapSamples is the number of grid cells along each side of the box in
+// which OverlapArea samples; 100×100 measures a territory-sized overlap to
+// within about a percent.
+const overlapSamples = 100
+
+// Bounds returns the longitude and latitude box around every position of the
+// geometry. ok is false for an empty geometry.
+func (g Geometry) Bounds() (minLon, minLat, maxLon, maxLat float64, ok bool) {
+	minLon, minLat = math.Inf(1), math.Inf(1)
+	maxLon, maxLat = math.Inf(-1), math.Inf(-1)
+	for _, p := range g.positions() {
+		minLon, maxLon = math.Min(minLon, p.Lon()), math.Max(maxLon, p.Lon())
+		minLat, maxLat = math.Min(minLat, p.Lat()), math.Max(maxLat, p.Lat())
+	}
+	return minLon, minLat, maxLon, maxLat, !math.IsInf(minLon, 1)
+}
+
+// positions returns every position of the geometry: its points and the
+// vertices of its lines and rings.
+func (g Geometry) positions() []Position {
+	positions := g.Points()
+	for _, line := range g.Lines() {
+		positions = append(positions, line...)
+	}
+	for _, p := range g.Polygons() {
+		for _, ring := range p {
+			positions = append(positions, ring...)
+		}
+	}
+	return positions
+}
+
+// Overlap reports whether the polygons of two geometries overlap, and
+// estimates the overlapping area in square metres. Polygons that only share
+// an edge or a corner, as neighbouring territories drawn against each other
+// do, don't overlap. The area is sampled on a grid, so an overlap too thin
+// to catch a sample is reported with an area of 0.
+func Overlap(a, b Geometry) (overlaps bool, areaM2 float64) {
+	aMinLon, aMinLat, aMaxLon, aMaxLat, aok := a.Bounds()
+	bMinLon, bMinLat, bMaxLon, bMaxLat, bok := b.Bounds()
+	if !aok || !bok || len(a.Polygons()) == 0 || len(b.Polygons()) == 0 {
+		return false, 0
+	}
+	minLon, maxLon := math.Max(aMinLon, bMinLon), math.Min(aMaxLon, bMaxLon)
+	minLat, maxLat := math.Max(aMinLat, bMinLat), math.Min(aMaxLat, bMaxLat)
+	if minLon >= maxLon || minLat >= maxLat {
+		return false, 0
+	}
+
+	proj := newProjection(Position{(minLon + maxLon) / 2, (minLat + maxLat) / 2})
+	dLon, dLat := (maxLon-minLon)/overlapSamples, (maxLat-minLat)/overlapSamples
+	cell := dLon * proj.kx * dLat * proj.ky
+	for i := 0; i < overlapSamples; i++ {
+		for j := 0; j < overlapSamples; j++ {
+			pos := Position{minLon + (float64(i)+0.5)*dLon, minLat + (float64(j)+0.5)*dLat}
+			if a.Contains(pos) && b.Contains(pos) {
+				areaM2 += cell
+			}
+		}
+	}
+	return areaM2 > 0 || edgesCross(proj, a, b), areaM2
+}
+
+// edgesCross reports whether an edge of one geometry's polygons properly
+// crosses an edge of the other's. Edges that touch or run along each other
+// within a few centimetres don't count.
+func edgesCross(proj projection, a, b Geometry) bool {
+	const tolerance = 0.05 // metres
+	type segment struct{ ax, ay, bx, by float64 }
+	segments := func(g Geometry) []segment {
+		var s []segment
+		for _, p := range g.Polygons() {
+			for _, ring := range p {
+				for i := 0; i+1 < len(ring); i++ {
+					ax, ay := proj.xy(ring[i])
+					bx, by := proj.xy(ring[i+1])
+					s = append(s, segment{ax, ay, bx, by})
+				}
+			}
+		}
+		return s
+	}
+	// side is the signed distance of (x, y) from the line through s.
+	side := func(s segment, x, y float64) float64 {
+		l := math.Hypot(s.bx-s.ax, s.by-s.ay)
+		if l == 0 {
+			return 0
+		}
+		return ((s.bx-s.ax)*(y-s.ay) - (s.by-s.ay)*(x-s.ax)) / l
+	}
+	opposite := func(d1, d2 float64) bool {
+		return (d1 > tolerance && d2 < -tolerance) || (d1 < -tolerance && d2 > tolerance)
+	}
+
+	bs := segments(b)
+	for _, s := range segments(a) {
+		for _, t := range bs {
+			if opposite(side(s, t.ax, t.ay), side(s, t.bx, t.by)) &&
+				opposite(side(t, s.ax, s.ay), side(t, s.bx, s.by)) {
+				return true
+			}
+		}
+	}
+	return false
+}
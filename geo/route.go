@@ -0,0 +1,103 @@
+package geo
+
+// OptimizeRoute orders stops to keep the total great-circle distance short:
+// a nearest-neighbour tour improved with 2-opt until no swap helps. The
+// route starts at start when given; otherwise every stop is tried as the
+// first one. It returns the indexes of stops in visiting order. The result
+// is a good route, not necessarily the best, which is plenty for a day's
+// handful of territories.
+func OptimizeRoute(start *Position, stops []Position) []int {
+	if len(stops) == 0 {
+		return nil
+	}
+
+	// Node 0 is the start when there is one; stop i is node i+offset.
+	offset := 0
+	nodes := stops
+	if start != nil {
+		offset = 1
+		nodes = append([]Position{*start}, stops...)
+	}
+	dist := make([][]float64, len(nodes))
+	for i := range nodes {
+		dist[i] = make([]float64, len(nodes))
+		for j := range nodes {
+			dist[i][j] = Distance(nodes[i], nodes[j])
+		}
+	}
+
+	var best []int
+	bestLength := 0.0
+	firsts := []int{0}
+	if start == nil {
+		firsts = firsts[:0]
+		for i := range nodes {
+			firsts = append(firsts, i)
+		}
+	}
+	for _, first := range firsts {
+		tour := twoOpt(nearestNeighbour(first, dist), dist)
+		if l := tourLength(tour, dist); best == nil || l < bestLength {
+			best, bestLength = tour, l
+		}
+	}
+
+	order := make([]int, 0, len(stops))
+	for _, node := range best[offset:] {
+		order = append(order, node-offset)
+	}
+	return order
+}
+
+func nearestNeighbour(first int, dist [][]float64) []int {
+	visited := make([]bool, len(dist))
+	tour := []int{first}
+	visited[first] = true
+	for len(tour) < len(dist) {
+		last, next := tour[len(tour)-1], -1
+		for j := range dist {
+			if !visited[j] && (next < 0 || dist[last][j] < dist[last][next]) {
+				next = j
+			}
+		}
+		visited[next] = true
+		tour = append(tour, next)
+	}
+	return tour
+}
+
+// twoOpt reverses segments of an open path while that shortens it. The first
+// node stays in place.
+func twoOpt(tour []int, dist [][]float64) []int {
+	for improved := true; improved; {
+		improved = false
+		for i := 1; i < len(tour)-1; i++ {
+			for k := i + 1; k < len(tour); k++ {
+				a, b := tour[i-1], tour[i]
+				c := tour[k]
+				before := dist[a][b]
+				after := dist[a][c]
+				if k+1 < len(tour) {
+					d := tour[k+1]
+					before += dist[c][d]
+					after += dist[b][d]
+				}
+				if after < before-1e-9 {
+					for l, r := i, k; l < r; l, r = l+1, r-1 {
+						tour[l], tour[r] = tour[r], tour[l]
+					}
+					improved = true
+				}
+			}
+		}
+	}
+	return tour
+}
+
+func tourLength(tour []int, dist [][]float64) float64 {
+	var total float64
+	for i := 0; i+1 < len(tour); i++ {
+		total += dist[tour[i]][tour[i+1]]
+	}
+	return total
+}
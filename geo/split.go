@@ -0,0 +1,220 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// divideIterations is the number of bisection steps used to place each cut
+// in DividePolygon, which puts it well under a metre from the exact place.
+const divideIterations = 50
+
+// SplitPolygon cuts a polygon in two along a line drawn across it. The line
+// must start and end outside the polygon and cross its outer boundary
+// exactly twice, without touching any hole; each hole goes to the part it
+// lies in. Coordinates are treated as planar, which is accurate at the scale
+// of a territory.
+func SplitPolygon(p Polygon, line []Position) (Polygon, Polygon, error) {
+	if len(p) == 0 || len(p[0]) < 4 {
+		return nil, nil, fmt.Errorf("polygon has no outer ring")
+	}
+	if len(line) < 2 {
+		return nil, nil, fmt.Errorf("line needs at least two positions")
+	}
+	if p.Contains(line[0]) || p.Contains(line[len(line)-1]) {
+		return nil, nil, fmt.Errorf("line must start and end outside the territory")
+	}
+
+	outer := p[0]
+	type crossing struct {
+		point Position
+		edge  int     // index of the ring edge crossed
+		along float64 // position around the ring: edge plus fraction
+		cut   int     // index of the line segment crossing it
+		at    float64 // position along the line: segment plus fraction
+	}
+	var crossings []crossing
+	for i := 0; i+1 < len(line); i++ {
+		for e := 0; e+1 < len(outer); e++ {
+			if pt, s, u, ok := segmentIntersection(line[i], line[i+1], outer[e], outer[e+1]); ok {
+				crossings = append(crossings, crossing{pt, e, float64(e) + u, i, float64(i) + s})
+			}
+		}
+		for _, hole := range p[1:] {
+			for e := 0; e+1 < len(hole); e++ {
+				if _, _, _, ok := segmentIntersection(line[i], line[i+1], hole[e], hole[e+1]); ok {
+					return nil, nil, fmt.Errorf("line must not cross a hole in the territory")
+				}
+			}
+		}
+	}
+	if len(crossings) != 2 {
+		return nil, nil, fmt.Errorf("line must cross the territory boundary exactly twice, not %d times", len(crossings))
+	}
+	sort.Slice(crossings, func(i, j int) bool { return crossings[i].at < crossings[j].at })
+
+	// The cut from the first crossing to the second, through the line's
+	// vertices in between.
+	a, b := crossings[0], crossings[1]
+	cut := []Position{a.point}
+	for k := a.cut + 1; k <= b.cut; k++ {
+		cut = append(cut, line[k])
+	}
+	cut = append(cut, b.point)
+	// Walk the ring from a to b, so make a the earlier crossing around it.
+	if a.along > b.along {
+		a, b = b, a
+		for i, j := 0, len(cut)-1; i < j; i, j = i+1, j-1 {
+			cut[i], cut[j] = cut[j], cut[i]
+		}
+	}
+
+	n := len(outer) - 1
+	first := Ring{a.point}
+	for v := a.edge + 1; v <= b.edge; v++ {
+		first = append(first, outer[v])
+	}
+	first = append(first, b.point)
+	for k := len(cut) - 2; k >= 1; k-- {
+		first = append(first, cut[k])
+	}
+	first = append(first, a.point)
+
+	second := Ring{b.point}
+	for v := b.edge + 1; v < n; v++ {
+		second = append(second, outer[v])
+	}
+	for v := 0; v <= a.edge; v++ {
+		second = append(second, outer[v])
+	}
+	second = append(second, a.point)
+	second = append(second, cut[1:]...)
+
+	one, two := Polygon{first}, Polygon{second}
+	for _, hole := range p[1:] {
+		if one.Contains(hole[0]) {
+			one = append(one, hole)
+		} else {
+			two = append(two, hole)
+		}
+	}
+	return one, two, nil
+}
+
+// segmentIntersection returns where segment a-b meets segment c-d, with
+// the fractions along each. Each segment includes its start but not its
+// end, so a line through a shared vertex crosses only one of the edges.
+func segmentIntersection(a, b, c, d Position) (Position, float64, float64, bool) {
+	rx, ry := b[0]-a[0], b[1]-a[1]
+	sx, sy := d[0]-c[0], d[1]-c[1]
+	denom := rx*sy - ry*sx
+	if denom == 0 {
+		return Position{}, 0, 0, false
+	}
+	t := ((c[0]-a[0])*sy - (c[1]-a[1])*sx) / denom
+	u := ((c[0]-a[0])*ry - (c[1]-a[1])*rx) / denom
+	if t < 0 || t >= 1 || u < 0 || u >= 1 {
+		return Position{}, 0, 0, false
+	}
+	return Position{a[0] + t*rx, a[1] + t*ry}, t, u, true
+}
+
+// DividePolygon splits a polygon into n parts of roughly equal area with
+// straight cuts, each across the longer side of the piece being cut. A
+// concave polygon can give a part made of pieces joined along a cut.
+func DividePolygon(p Polygon, n int) []Polygon {
+	if n <= 1 || len(p) == 0 {
+		return []Polygon{p}
+	}
+
+	minLon, minLat, maxLon, maxLat, _ := NewPolygon(p).Bounds()
+	proj := newProjection(Position{(minLon + maxLon) / 2, (minLat + maxLat) / 2})
+	axis, lo, hi := 0, minLon, maxLon
+	if (maxLat-minLat)*proj.ky > (maxLon-minLon)*proj.kx {
+		axis, lo, hi = 1, minLat, maxLat
+	}
+
+	k := n / 2
+	target := NewPolygon(p).Area() * float64(k) / float64(n)
+	for i := 0; i < divideIterations; i++ {
+		mid := (lo + hi) / 2
+		if NewPolygon(clipPolygon(p, axis, mid, true)).Area() < target {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	at := (lo + hi) / 2
+	below, above := clipPolygon(p, axis, at, true), clipPolygon(p, axis, at, false)
+	return append(DividePolygon(below, k), DividePolygon(above, n-k)...)
+}
+
+// clipPolygon keeps the part of a polygon on one side of a line of constant
+// longitude (axis 0) or latitude (axis 1).
+func clipPolygon(p Polygon, axis int, at float64, below bool) Polygon {
+	outer := clipRing(p[0], axis, at, below)
+	if outer == nil {
+		return nil
+	}
+	clipped := Polygon{outer}
+	for _, hole := range p[1:] {
+		if h := clipRing(hole, axis, at, below); h != nil {
+			clipped = append(clipped, h)
+		}
+	}
+	return clipped
+}
+
+// clipRing is the Sutherland-Hodgman algorithm against a single line.
+func clipRing(r Ring, axis int, at float64, below bool) Ring {
+	inside := func(pos Position) bool {
+		if below {
+			return pos[axis] <= at
+		}
+		return pos[axis] >= at
+	}
+	crossing := func(a, b Position) Position {
+		t := (at - a[axis]) / (b[axis] - a[axis])
+		pos := Position{a[0] + t*(b[0]-a[0]), a[1] + t*(b[1]-a[1])}
+		pos[axis] = at
+		return pos
+	}
+
+	pts := openRing(r)
+	var out Ring
+	for i, cur := range pts {
+		prev := pts[(i+len(pts)-1)%len(pts)]
+		switch {
+		case inside(cur) && !inside(prev):
+			out = append(out, crossing(prev, cur), cur)
+		case inside(cur):
+			out = append(out, cur)
+		case inside(prev):
+			out = append(out, crossing(prev, cur))
+		}
+	}
+	if len(out) < 3 {
+		return nil
+	}
+	return append(out, out[0])
+}
+
+// Gap returns the distance in metres between two geometries: 0 if they
+// overlap or touch, otherwise the shortest distance from a vertex of one to
+// the other.
+func Gap(a, b Geometry) float64 {
+	gap := math.Inf(1)
+	for _, pos := range a.positions() {
+		gap = math.Min(gap, b.DistanceTo(pos))
+	}
+	for _, pos := range b.positions() {
+		gap = math.Min(gap, a.DistanceTo(pos))
+	}
+	if gap > 0 {
+		if overlaps, _ := Overlap(a, b); overlaps {
+			return 0
+		}
+	}
+	return gap
+}
@@ -0,0 +1,314 @@
+package geo
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// rect is a closed, counter-clockwise rectangular ring.
+func rect(minLon, minLat, maxLon, maxLat float64) Ring {
+	return Ring{{minLon, minLat}, {maxLon, minLat}, {maxLon, maxLat}, {minLon, maxLat}, {minLon, minLat}}
+}
+
+// uShape is a territory of about 300 m a side with a notch cut into its top,
+// so a straight line across the arms crosses the boundary four times.
+var uShape = Polygon{{
+	{0, 0}, {0.003, 0}, {0.003, 0.003}, {0.002, 0.003}, {0.002, 0.001},
+	{0.001, 0.001}, {0.001, 0.003}, {0, 0.003}, {0, 0},
+}}
+
+// planarArea is the shoelace area of a polygon with its holes taken out, in
+// the coordinates' own units, which SplitPolygon conserves exactly.
+func planarArea(p Polygon) float64 {
+	var total float64
+	for i, ring := range p {
+		a, _, _ := ring.moments()
+		if i == 0 {
+			total += math.Abs(a)
+		} else {
+			total -= math.Abs(a)
+		}
+	}
+	return total
+}
+
+func closed(r Ring) bool {
+	return len(r) >= 4 && r[0] == r[len(r)-1]
+}
+
+func TestSplitPolygon(t *testing.T) {
+	square := Polygon{rect(0, 0, 0.002, 0.002)}
+	withHole := Polygon{rect(0, 0, 0.004, 0.002), rect(0.0005, 0.0005, 0.0015, 0.0015)}
+
+	tests := []struct {
+		name    string
+		polygon Polygon
+		line    []Position
+		// areas are the planar areas of the two parts, in either order.
+		areas [2]float64
+		// holeIn is the position of a point inside the hole, which must
+		// end up in the part with two rings.
+		holeIn *Position
+	}{
+		{
+			name:    "straight across a square",
+			polygon: square,
+			line:    []Position{{0.0005, -0.001}, {0.0005, 0.003}},
+			areas:   [2]float64{0.0005 * 0.002, 0.0015 * 0.002},
+		},
+		{
+			name:    "through opposite corners",
+			polygon: square,
+			line:    []Position{{-0.001, -0.001}, {0.003, 0.003}},
+			areas:   [2]float64{0.000002, 0.000002},
+		},
+		{
+			name:    "with a bend inside",
+			polygon: square,
+			line:    []Position{{0.001, -0.001}, {0.001, 0.001}, {0.003, 0.001}},
+			areas:   [2]float64{0.001 * 0.001, 0.000004 - 0.001*0.001},
+		},
+		{
+			name:    "past a hole",
+			polygon: withHole,
+			line:    []Position{{0.0025, -0.001}, {0.0025, 0.003}},
+			areas:   [2]float64{0.0025*0.002 - 0.001*0.001, 0.0015 * 0.002},
+			holeIn:  &Position{0.001, 0.001},
+		},
+		{
+			// The line starts in the notch, outside the territory, and
+			// leaves through the bottom edge.
+			name:    "concave, down from the notch",
+			polygon: uShape,
+			line:    []Position{{0.0015, 0.002}, {0.0015, -0.001}},
+			areas:   [2]float64{0.0015*0.001 + 0.001*0.002, 0.0015*0.001 + 0.001*0.002},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			one, two, err := SplitPolygon(tt.polygon, tt.line)
+			if err != nil {
+				t.Fatalf("SplitPolygon: %v", err)
+			}
+			for _, part := range []Polygon{one, two} {
+				for _, ring := range part {
+					if !closed(ring) {
+						t.Errorf("ring %v is not closed", ring)
+					}
+				}
+			}
+
+			total := planarArea(tt.polygon)
+			a, b := planarArea(one), planarArea(two)
+			if math.Abs(a+b-total) > total*1e-9 {
+				t.Errorf("parts add up to %g, want the original %g", a+b, total)
+			}
+			if a > b {
+				a, b = b, a
+			}
+			want := tt.areas
+			if want[0] > want[1] {
+				want[0], want[1] = want[1], want[0]
+			}
+			if math.Abs(a-want[0]) > total*1e-9 || math.Abs(b-want[1]) > total*1e-9 {
+				t.Errorf("part areas are %g and %g, want %g and %g", a, b, want[0], want[1])
+			}
+
+			if tt.holeIn != nil {
+				holed, other := one, two
+				if len(two) > len(one) {
+					holed, other = two, one
+				}
+				if len(holed) != 2 || len(other) != 1 {
+					t.Fatalf("got parts with %d and %d rings, want the hole in one of them", len(one), len(two))
+				}
+				if !holed[0].contains(*tt.holeIn) || holed.Contains(*tt.holeIn) {
+					t.Errorf("hole went to the part that doesn't surround it")
+				}
+			}
+		})
+	}
+}
+
+func TestSplitPolygonRejectsLines(t *testing.T) {
+	square := Polygon{rect(0, 0, 0.002, 0.002)}
+	withHole := Polygon{rect(0, 0, 0.004, 0.002), rect(0.0005, 0.0005, 0.0015, 0.0015)}
+
+	tests := []struct {
+		name    string
+		polygon Polygon
+		line    []Position
+		err     string
+	}{
+		{
+			name:    "misses the territory",
+			polygon: square,
+			line:    []Position{{-0.001, -0.001}, {-0.001, 0.003}},
+			err:     "not 0 times",
+		},
+		{
+			name:    "crosses once and ends inside",
+			polygon: square,
+			line:    []Position{{0.001, -0.001}, {0.001, 0.001}},
+			err:     "start and end outside",
+		},
+		{
+			name:    "crosses three times and ends inside",
+			polygon: uShape,
+			line:    []Position{{-0.001, 0.002}, {0.0025, 0.002}},
+			err:     "start and end outside",
+		},
+		{
+			name:    "crosses both arms",
+			polygon: uShape,
+			line:    []Position{{-0.001, 0.002}, {0.004, 0.002}},
+			err:     "not 4 times",
+		},
+		{
+			name:    "crosses a hole",
+			polygon: withHole,
+			line:    []Position{{0.001, -0.001}, {0.001, 0.003}},
+			err:     "hole",
+		},
+		{
+			name:    "too short",
+			polygon: square,
+			line:    []Position{{-0.001, -0.001}},
+			err:     "at least two positions",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := SplitPolygon(tt.polygon, tt.line)
+			if err == nil {
+				t.Fatalf("SplitPolygon succeeded, want an error containing %q", tt.err)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %q, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDividePolygon(t *testing.T) {
+	tests := []struct {
+		name    string
+		polygon Polygon
+		parts   int
+	}{
+		{"square in two", Polygon{rect(0, 0, 0.002, 0.002)}, 2},
+		{"wide rectangle in three", Polygon{rect(10, 50, 10.01, 50.002)}, 3},
+		{"tall rectangle in five", Polygon{rect(-76.3, 36.8, -76.299, 36.81)}, 5},
+		{"square with a hole in four", Polygon{rect(0, 0, 0.004, 0.004), rect(0.001, 0.001, 0.003, 0.003)}, 4},
+		{"concave in two", uShape, 2},
+		{"concave in three", uShape, 3},
+		{"concave in four", uShape, 4},
+		{"one part", uShape, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := DividePolygon(tt.polygon, tt.parts)
+			if len(parts) != tt.parts {
+				t.Fatalf("got %d parts, want %d", len(parts), tt.parts)
+			}
+
+			total := NewPolygon(tt.polygon).Area()
+			var sum float64
+			for i, part := range parts {
+				for _, ring := range part {
+					if !closed(ring) {
+						t.Errorf("part %d has an unclosed ring", i)
+					}
+				}
+				area := NewPolygon(part).Area()
+				sum += area
+				// Bisection puts each cut well under a metre from the
+				// exact place, so every part is within a percent.
+				if want := total / float64(tt.parts); math.Abs(area-want) > want*0.01 {
+					t.Errorf("part %d has area %.1f m², want about %.1f m²", i, area, want)
+				}
+			}
+			if math.Abs(sum-total) > total*1e-6 {
+				t.Errorf("parts add up to %.3f m², want the original %.3f m²", sum, total)
+			}
+		})
+	}
+}
+
+func TestClipRing(t *testing.T) {
+	square := rect(0, 0, 2, 2)
+
+	tests := []struct {
+		name  string
+		ring  Ring
+		axis  int
+		at    float64
+		below bool
+		// area is the planar area kept; 0 means nothing is left.
+		area float64
+	}{
+		{"left part", square, 0, 0.5, true, 1},
+		{"right part", square, 0, 0.5, false, 3},
+		{"bottom part", square, 1, 1.5, true, 3},
+		{"top part", square, 1, 1.5, false, 1},
+		{"all of it", square, 0, 5, true, 4},
+		{"none of it", square, 0, -1, true, 0},
+		{"concave both arms", uShape[0], 1, 0.002, false, 0.000002},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clipped := clipRing(tt.ring, tt.axis, tt.at, tt.below)
+			if tt.area == 0 {
+				if clipped != nil {
+					t.Errorf("got %v, want nothing", clipped)
+				}
+				return
+			}
+			if !closed(clipped) {
+				t.Fatalf("clipped ring %v is not closed", clipped)
+			}
+			for _, pos := range clipped {
+				if tt.below && pos[tt.axis] > tt.at || !tt.below && pos[tt.axis] < tt.at {
+					t.Errorf("position %v is on the wrong side of %g", pos, tt.at)
+				}
+			}
+			if area, _, _ := clipped.moments(); math.Abs(math.Abs(area)-tt.area) > tt.area*1e-9 {
+				t.Errorf("kept area %g, want %g", math.Abs(area), tt.area)
+			}
+		})
+	}
+}
+
+func TestGap(t *testing.T) {
+	square := NewPolygon(Polygon{rect(0, 0, 0.001, 0.001)})
+	// A degree of longitude along the equator.
+	degree := Distance(Position{0, 0}, Position{1, 0})
+
+	tests := []struct {
+		name string
+		a, b Geometry
+		gap  float64
+	}{
+		{"apart", square, NewPolygon(Polygon{rect(0.002, 0, 0.003, 0.001)}), 0.001 * degree},
+		{"touching", square, NewPolygon(Polygon{rect(0.001, 0, 0.002, 0.001)}), 0},
+		{"overlapping", square, NewPolygon(Polygon{rect(0.0005, 0.0005, 0.0015, 0.0015)}), 0},
+		{"one inside the other", NewPolygon(Polygon{rect(-0.001, -0.001, 0.002, 0.002)}), square, 0},
+		{"point inside", square, NewPoint(0.0005, 0.0005), 0},
+		{"point beside", square, NewPoint(0.0015, 0.0005), 0.0005 * degree},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, pair := range [][2]Geometry{{tt.a, tt.b}, {tt.b, tt.a}} {
+				if gap := Gap(pair[0], pair[1]); math.Abs(gap-tt.gap) > 0.01 {
+					t.Errorf("Gap = %.3f m, want %.3f m", gap, tt.gap)
+				}
+			}
+		})
+	}
+}
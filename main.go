@@ -1,54 +1,101 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"team-tracker-backend/controllers"
 	"team-tracker-backend/database"
 	"team-tracker-backend/routes"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
 )
 
 func main() {
+	reset := flag.Bool("reset", false, "wipe the database and re-seed it from the KML file")
+	reimport := flag.Bool("reimport", false, "re-import locations from the KML file even if the database already has some")
+	kmlFile := flag.String("kml", "Hampton Roads Lost Sheep Fields.kml", "KML file to seed locations from, relative to the working directory")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [migrate status|up [n]|down [n]]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	// Print current working directory
 	cwd, _ := os.Getwd()
 	log.Printf("Current working directory: %s", cwd)
 
-	// Clean up any existing database files
-	for _, dbName := range []string{"team-tracker.db", "team_tracker.db"} {
-		if _, err := os.Stat(dbName); err == nil {
-			log.Printf("Removing existing database file: %s", dbName)
-			os.Remove(dbName)
-		}
-	}
-
 	// Initialize database
-	db := database.InitDB()
+	db := database.InitDB(*reset)
 	defer db.Close()
 
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrateCommand(db, flag.Args()[1:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
 	// Run migrations
 	log.Println("Running database migrations...")
 	database.MigrateDB(db)
+	if err := controllers.RefreshLocationMetrics(db); err != nil {
+		log.Fatalf("Failed to compute location metrics: %v", err)
+	}
+	if err := controllers.RollCoverageCycle(db); err != nil {
+		log.Fatalf("Failed to roll over coverage cycle: %v", err)
+	}
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := controllers.RollCoverageCycle(db); err != nil {
+				log.Printf("Error rolling over coverage cycle: %v", err)
+			}
+		}
+	}()
 
-	// Verify KML file exists
-	kmlPath := filepath.Join(cwd, "Hampton Roads Lost Sheep Fields.kml")
-	if _, err := os.Stat(kmlPath); err != nil {
-		log.Fatalf("KML file not found at %s: %v", kmlPath, err)
+	// Only seed locations on an empty database unless a re-import was requested
+	var existing int
+	if err := db.Get(&existing, "SELECT COUNT(*) FROM locations WHERE is_retired = FALSE"); err != nil {
+		log.Fatalf("Failed to count locations: %v", err)
 	}
-	log.Printf("Found KML file at: %s", kmlPath)
 
-	// Populate locations
-	log.Println("Starting location population from KML...")
-	if err := controllers.PopulateLocations(db, kmlPath); err != nil {
-		log.Printf("Warning: Error populating locations: %v", err)
+	if existing == 0 || *reimport {
+		kmlPath := *kmlFile
+		if !filepath.IsAbs(kmlPath) {
+			kmlPath = filepath.Join(cwd, kmlPath)
+		}
+
+		// Territories can also be uploaded through /api/imports, so a missing
+		// seed file is not fatal.
+		if _, err := os.Stat(kmlPath); err != nil {
+			log.Printf("KML file not found at %s, starting without seeding locations: %v", kmlPath, err)
+		} else {
+			log.Printf("Found KML file at: %s", kmlPath)
+
+			// Populate locations
+			log.Println("Starting location population from KML...")
+			summary, err := controllers.PopulateLocations(db, kmlPath)
+			if err != nil {
+				log.Printf("Warning: Error populating locations: %v", err)
+			} else {
+				for _, change := range summary.Changes {
+					log.Printf("  %s: %s (id %d)", change.Action, change.Name, change.LocationID)
+				}
+			}
+		}
+	} else {
+		log.Printf("Database already has %d locations, skipping KML import (use -reimport to force)", existing)
 	}
 
 	// Verify data was populated
 	var locationCount int
-	if err := db.Get(&locationCount, "SELECT COUNT(*) FROM locations"); err != nil {
+	if err := db.Get(&locationCount, "SELECT COUNT(*) FROM locations WHERE is_retired = FALSE"); err != nil {
 		log.Printf("Error counting locations: %v", err)
 	} else {
 		log.Printf("Total locations in database: %d", locationCount)
@@ -71,3 +118,45 @@ func main() {
 	log.Println("Server running on http://localhost:8080")
 	router.Run(":8080")
 }
+
+// runMigrateCommand handles "migrate status", "migrate up [n]" and
+// "migrate down [n]" without starting the server.
+func runMigrateCommand(db *sqlx.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected one of: status, up, down")
+	}
+
+	steps := 0
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid step count %q", args[1])
+		}
+		steps = n
+	}
+
+	switch args[0] {
+	case "status":
+		statuses, err := database.GetMigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied"
+				if s.AppliedAt != nil {
+					state += " " + s.AppliedAt.Format(time.RFC3339)
+				}
+			}
+			fmt.Printf("%04d  %-40s %s\n", s.Version, s.Name, state)
+		}
+		return nil
+	case "up":
+		return database.MigrateUp(db, steps)
+	case "down":
+		return database.MigrateDown(db, steps)
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
@@ -1,23 +1,15 @@
 package routes
 
 import (
+	"database/sql"
 	"log"
 	"net/http"
-	"time"
+	"team-tracker-backend/controllers"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 )
 
-type LocationVisit struct {
-	ID         int       `json:"id" db:"id"`
-	LocationID int       `json:"location_id" db:"location_id"`
-	TeamID     int       `json:"team_id" db:"team_id"`
-	VisitDate  time.Time `json:"visit_date" db:"visit_date"`
-	IsPreached bool      `json:"is_preached" db:"is_preached"`
-	Notes      string    `json:"notes" db:"notes"`
-}
-
 type LocationStatus struct {
 	ID         int     `json:"id" db:"id"`
 	Name       string  `json:"name" db:"name"`
@@ -33,129 +25,102 @@ type Statistics struct {
 	PreachedLocations int `json:"preached_locations"`
 	ActiveTeams       int `json:"active_teams"`
 	TotalVisits       int `json:"total_visits"`
+
+	// Coverage of the active locations, as a fraction from 0 to 1: by
+	// count, by area, and by estimated doors. Door coverage only counts
+	// locations that have a door count.
+	LocationCoverage       float64 `json:"location_coverage"`
+	TotalAreaM2            float64 `json:"total_area_m2"`
+	PreachedAreaM2         float64 `json:"preached_area_m2"`
+	AreaCoverage           float64 `json:"area_coverage"`
+	LocationsWithDoorCount int     `json:"locations_with_door_count"`
+	TotalDoors             int     `json:"total_doors"`
+	PreachedDoors          int     `json:"preached_doors"`
+	DoorCoverage           float64 `json:"door_coverage"`
+
+	// Outcomes recorded on visits, by outcome.
+	Outcomes []controllers.OutcomeTotal `json:"outcomes"`
+
+	// The figures above are all-time; CurrentCycle is the progress within
+	// the current campaign, or null before any campaign has started.
+	CurrentCycle *controllers.CampaignProgress `json:"current_cycle"`
 }
 
 func SetupRoutes(router *gin.Engine, db *sqlx.DB) {
-	// Initialize database with new tables
-	initializeTables(db)
-
-	// Get all locations
-	router.GET("/api/locations", func(c *gin.Context) {
-		var locations []struct {
-			ID        int     `json:"id" db:"id"`
-			Name      string  `json:"name" db:"name"`
-			Latitude  float64 `json:"latitude" db:"latitude"`
-			Longitude float64 `json:"longitude" db:"longitude"`
-		}
+	// Get all locations, optionally filtered by region or bounding box
+	router.GET("/api/locations", controllers.GetLocations(db))
 
-		err := db.Select(&locations, "SELECT id, name, latitude, longitude FROM locations")
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
-			return
-		}
+	// Find locations near a point, or the territories containing it
+	router.GET("/api/locations/nearby", controllers.GetNearbyLocations(db))
+	router.GET("/api/locations/at", controllers.GetLocationsAt(db))
 
-		c.JSON(http.StatusOK, locations)
-	})
+	// Find overlapping and duplicate territories
+	router.GET("/api/locations/conflicts", controllers.GetLocationConflicts(db))
 
-	// Get available locations
-	router.GET("/api/locations/available", func(c *gin.Context) {
-		var locations []struct {
-			ID        int     `json:"id" db:"id"`
-			Name      string  `json:"name" db:"name"`
-			Latitude  float64 `json:"latitude" db:"latitude"`
-			Longitude float64 `json:"longitude" db:"longitude"`
-		}
+	// Regions imported from KML folders
+	router.GET("/api/regions", controllers.GetRegions(db))
+	router.GET("/api/regions/:id/locations", controllers.GetRegionLocations(db))
 
-		// Modified query to handle is_preached correctly
-		query := `
-            SELECT id, name, latitude, longitude 
-            FROM locations 
-            WHERE is_preached = FALSE 
-            ORDER BY name
-        `
-
-		if err := db.Select(&locations, query); err != nil {
-			log.Printf("Error fetching available locations: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
-			return
-		}
-
-		c.JSON(http.StatusOK, locations)
-	})
+	// Get available locations: unpreached and not checked out to a team
+	router.GET("/api/locations/available", controllers.GetAvailableLocations(db))
 
-	// Record a visit to a location
-	router.POST("/api/visits", func(c *gin.Context) {
-		var visit LocationVisit
-		if err := c.ShouldBindJSON(&visit); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
-			return
-		}
+	// Upload KML/KMZ territory files
+	router.POST("/api/imports", controllers.CreateImport(db))
+	router.GET("/api/imports", controllers.GetImports(db))
+	router.GET("/api/imports/:id", controllers.GetImport(db))
+	router.POST("/api/imports/geojson", controllers.CreateGeoJSONImport(db))
+	router.POST("/api/imports/csv/locations", controllers.ImportLocationsCSV(db))
+	router.POST("/api/imports/csv/teams", controllers.ImportTeamsCSV(db))
 
-		query := `
-            INSERT INTO location_visits 
-            (location_id, team_id, visit_date, is_preached, notes) 
-            VALUES (?, ?, ?, ?, ?)`
-
-		result, err := db.Exec(query,
-			visit.LocationID,
-			visit.TeamID,
-			time.Now(),
-			visit.IsPreached,
-			visit.Notes,
-		)
+	// Export locations for GIS tools and Google Earth
+	router.GET("/api/export/locations.geojson", controllers.ExportLocationsGeoJSON(db))
+	router.GET("/api/export/territories.kml", controllers.ExportTerritoriesKML(db))
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record visit"})
-			return
-		}
+	// Export spreadsheets
+	router.GET("/api/export/visits.csv", controllers.ExportVisitsCSV(db))
+	router.GET("/api/export/locations.csv", controllers.ExportLocationStatusCSV(db))
+	router.GET("/api/export/assignments.csv", controllers.ExportAssignmentsCSV(db))
 
-		// Update location's preached status if needed
-		if visit.IsPreached {
-			_, err = db.Exec(
-				"UPDATE locations SET is_preached = true WHERE id = ?",
-				visit.LocationID,
-			)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location status"})
-				return
-			}
-		}
+	// Record a visit to a location, and list a location's visits
+	router.POST("/api/visits", controllers.RecordVisit(db))
+	router.GET("/api/locations/:id/visits", controllers.GetLocationVisits(db))
 
-		id, _ := result.LastInsertId()
-		visit.ID = int(id)
-		c.JSON(http.StatusCreated, visit)
-	})
+	// The catalog of outcomes a visit can record
+	router.GET("/api/visit-outcomes", controllers.GetVisitOutcomes(db))
+	router.POST("/api/visit-outcomes", controllers.AddVisitOutcome(db))
+	router.PUT("/api/visit-outcomes/:id", controllers.UpdateVisitOutcome(db))
 
-	// Get visit history for a location
-	router.GET("/api/locations/:id/visits", func(c *gin.Context) {
-		locationID := c.Param("id")
-		var visits []LocationVisit
+	// Get a single location with its description and media
+	router.GET("/api/locations/:id", controllers.GetLocation(db))
 
-		err := db.Select(&visits, `
-            SELECT * FROM location_visits 
-            WHERE location_id = ? 
-            ORDER BY visit_date DESC`, locationID)
+	// Get the full geometry of a location
+	router.GET("/api/locations/:id/geometry", controllers.GetLocationGeometry(db))
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch visits"})
-			return
-		}
+	// Set the estimated door count of a location
+	router.PATCH("/api/locations/:id", controllers.UpdateLocation(db))
 
-		c.JSON(http.StatusOK, visits)
-	})
+	// Split and merge territories, and trace what they were made from
+	router.POST("/api/locations/:id/split", controllers.SplitLocation(db))
+	router.POST("/api/locations/merge", controllers.MergeLocations(db))
+	router.GET("/api/locations/:id/lineage", controllers.GetLocationLineage(db))
 
-	// Get all locations with their status
+	// Get all locations with their status; is_preached is for the current
+	// campaign, the visit figures all-time
 	router.GET("/api/locations/status", func(c *gin.Context) {
 		var locations []LocationStatus
 
 		query := `
             SELECT 
-                l.*,
+                l.id,
+                l.name,
+                l.latitude,
+                l.longitude,
                 COALESCE(MAX(v.visit_date), '') as last_visit,
                 COUNT(v.id) as visit_count,
-                COALESCE(MAX(v.is_preached), false) as is_preached
+                l.is_preached
             FROM locations l
-            LEFT JOIN location_visits v ON l.id = v.location_id
+            LEFT JOIN location_visits v ON v.location_id IN (` + controllers.LineageLocationIDs + `)
+            WHERE l.is_retired = FALSE
             GROUP BY l.id`
 
 		err := db.Select(&locations, query)
@@ -172,15 +137,19 @@ func SetupRoutes(router *gin.Engine, db *sqlx.DB) {
 		var stats Statistics
 
 		// Get total locations
-		err := db.Get(&stats.TotalLocations, "SELECT COUNT(*) FROM locations")
+		err := db.Get(&stats.TotalLocations, "SELECT COUNT(*) FROM locations WHERE is_retired = FALSE")
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
 			return
 		}
 
-		// Get preached locations
-		err = db.Get(&stats.PreachedLocations,
-			"SELECT COUNT(DISTINCT location_id) FROM location_visits WHERE is_preached = true")
+		// Get preached locations, counting visits to the locations they were
+		// split or merged from
+		err = db.Get(&stats.PreachedLocations, `
+            SELECT COUNT(*) FROM locations l
+            WHERE l.is_retired = FALSE AND EXISTS (
+                SELECT 1 FROM location_visits v
+                WHERE v.location_id IN (`+controllers.LineageLocationIDs+`) AND v.is_preached = true)`)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
 			return
@@ -202,87 +171,92 @@ func SetupRoutes(router *gin.Engine, db *sqlx.DB) {
 			return
 		}
 
-		c.JSON(http.StatusOK, stats)
-	})
-
-	// Create a new team
-	router.GET("/api/teams", func(c *gin.Context) {
-		var teams []struct {
-			ID     int    `json:"id" db:"id"`
-			Name   string `json:"name" db:"name"`
-			Leader string `json:"leader" db:"leader"`
-		}
-		err := db.Select(&teams, "SELECT id, name, leader FROM teams")
+		// Get coverage weighted by area and doors
+		var coverage struct {
+			Locations         int     `db:"locations"`
+			PreachedLocations int     `db:"preached_locations"`
+			TotalArea         float64 `db:"total_area"`
+			PreachedArea      float64 `db:"preached_area"`
+			WithDoors         int     `db:"with_doors"`
+			TotalDoors        int     `db:"total_doors"`
+			PreachedDoors     int     `db:"preached_doors"`
+		}
+		err = db.Get(&coverage, `
+            SELECT COUNT(*) as locations,
+                   COALESCE(SUM(preached), 0) as preached_locations,
+                   COALESCE(SUM(area_m2), 0) as total_area,
+                   COALESCE(SUM(CASE WHEN preached THEN area_m2 END), 0) as preached_area,
+                   COUNT(door_count) as with_doors,
+                   COALESCE(SUM(door_count), 0) as total_doors,
+                   COALESCE(SUM(CASE WHEN preached THEN door_count END), 0) as preached_doors
+            FROM (
+                SELECT l.area_m2, l.door_count,
+                       EXISTS (SELECT 1 FROM location_visits v
+                               WHERE v.location_id IN (`+controllers.LineageLocationIDs+`)
+                                 AND v.is_preached = true) as preached
+                FROM locations l
+                WHERE l.is_retired = FALSE
+            )`)
 		if err != nil {
-			log.Printf("Error fetching teams: %v", err) // Add logging
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch teams"})
+			log.Printf("Error fetching coverage statistics: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
 			return
 		}
-		c.JSON(http.StatusOK, teams)
-	})
-
-	router.POST("/api/teams", func(c *gin.Context) {
-		var team struct {
-			Name   string `json:"name"`
-			Leader string `json:"leader"`
+		stats.TotalAreaM2 = coverage.TotalArea
+		stats.PreachedAreaM2 = coverage.PreachedArea
+		stats.LocationsWithDoorCount = coverage.WithDoors
+		stats.TotalDoors = coverage.TotalDoors
+		stats.PreachedDoors = coverage.PreachedDoors
+		if coverage.Locations > 0 {
+			stats.LocationCoverage = float64(coverage.PreachedLocations) / float64(coverage.Locations)
 		}
-		if err := c.ShouldBindJSON(&team); err != nil {
-			log.Printf("Error binding JSON: %v", err) // Add logging
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
-			return
+		if coverage.TotalArea > 0 {
+			stats.AreaCoverage = coverage.PreachedArea / coverage.TotalArea
+		}
+		if coverage.TotalDoors > 0 {
+			stats.DoorCoverage = float64(coverage.PreachedDoors) / float64(coverage.TotalDoors)
 		}
 
-		result, err := db.Exec(
-			"INSERT INTO teams (name, leader) VALUES (?, ?)",
-			team.Name, team.Leader,
-		)
+		// Get visit outcomes
+		stats.Outcomes, err = controllers.OutcomeTotals(db)
 		if err != nil {
-			log.Printf("Error creating team: %v", err) // Add logging
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create team"})
+			log.Printf("Error fetching outcome statistics: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
 			return
 		}
 
-		id, _ := result.LastInsertId()
-		c.JSON(http.StatusCreated, gin.H{
-			"id":     id,
-			"name":   team.Name,
-			"leader": team.Leader,
-		})
-	})
-
-	// Update a team
-	router.PUT("/api/teams/:id", func(c *gin.Context) {
-		id := c.Param("id")
-		var team struct {
-			Name   string `json:"name"`
-			Leader string `json:"leader"`
-		}
-		if err := c.ShouldBindJSON(&team); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		// Get progress within the current campaign
+		current, err := controllers.CurrentCampaign(db)
+		if err == nil {
+			stats.CurrentCycle = &current
+		} else if err != sql.ErrNoRows {
+			log.Printf("Error fetching campaign statistics: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
 			return
 		}
 
-		_, err := db.Exec(
-			"UPDATE teams SET name = ?, leader = ? WHERE id = ?",
-			team.Name, team.Leader, id,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update team"})
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{"message": "Team updated successfully"})
+		c.JSON(http.StatusOK, stats)
 	})
 
-	// Delete a team
-	router.DELETE("/api/teams/:id", func(c *gin.Context) {
-		id := c.Param("id")
-		_, err := db.Exec("DELETE FROM teams WHERE id = ?", id)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete team"})
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{"message": "Team deleted successfully"})
-	})
+	// Coverage cycles: locations are preached afresh in each campaign
+	router.GET("/api/campaigns", controllers.GetCampaigns(db))
+	router.GET("/api/campaigns/current", controllers.GetCurrentCampaign(db))
+	router.POST("/api/campaigns", controllers.OpenCampaign(db))
+
+	// Teams, with their leader and members taken from team memberships
+	router.GET("/api/teams", controllers.GetTeams(db))
+	router.POST("/api/teams", controllers.AddTeam(db))
+	router.PUT("/api/teams/:id", controllers.UpdateTeam(db))
+	router.DELETE("/api/teams/:id", controllers.DeleteTeam(db))
+
+	// Team rosters
+	router.GET("/api/teams/:id/members", controllers.GetTeamMembers(db))
+	router.POST("/api/teams/:id/members", controllers.AddTeamMember(db))
+	router.DELETE("/api/teams/:id/members/:memberId", controllers.RemoveTeamMember(db))
+
+	// Distribute unassigned locations among teams automatically
+	router.POST("/api/assignments/auto/preview", controllers.PreviewAutoAssign(db))
+	router.POST("/api/assignments/auto/commit", controllers.CommitAutoAssign(db))
 
 	// Plan visits for a team
 	router.POST("/api/teams/:id/plan", func(c *gin.Context) {
@@ -327,113 +301,26 @@ func SetupRoutes(router *gin.Engine, db *sqlx.DB) {
 		c.JSON(http.StatusOK, gin.H{"message": "Visits planned successfully"})
 	})
 
-	// Get team assignments
-	// Get team assignments - keep this GET endpoint
-	router.GET("/api/teams/:id/assignments", func(c *gin.Context) {
-		teamID := c.Param("id")
-		var assignments []struct {
-			ID            int        `json:"id" db:"id"`
-			LocationID    int        `json:"location_id" db:"location_id"`
-			LocationName  string     `json:"location_name" db:"location_name"`
-			IsCompleted   bool       `json:"is_completed" db:"is_completed"`
-			AssignedDate  time.Time  `json:"assigned_date" db:"assigned_date"`
-			CompletedDate *time.Time `json:"completed_date" db:"completed_date"`
-		}
-
-		query := `
-        SELECT 
-            ta.id,
-            ta.location_id,
-            l.name as location_name,
-            ta.is_completed,
-            ta.assigned_date,
-            ta.completed_date
-        FROM team_assignments ta
-        JOIN locations l ON ta.location_id = l.id
-        WHERE ta.team_id = ?
-        ORDER BY ta.is_completed, l.name
-    `
-
-		if err := db.Select(&assignments, query, teamID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignments"})
-			return
-		}
-
-		c.JSON(http.StatusOK, assignments)
-	})
-
-	// Assign locations to team - change this to POST endpoint
-	router.POST("/api/teams/:id/assignments", func(c *gin.Context) {
-		teamID := c.Param("id")
-		var request struct {
-			LocationIDs []int `json:"location_ids"`
-		}
-
-		if err := c.ShouldBindJSON(&request); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
-			return
-		}
-
-		tx, err := db.Beginx()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
-			return
-		}
-
-		for _, locationID := range request.LocationIDs {
-			_, err := tx.Exec(`
-            INSERT INTO team_assignments (team_id, location_id)
-            VALUES (?, ?)
-            ON CONFLICT(team_id, location_id) DO NOTHING
-        `, teamID, locationID)
-
-			if err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign locations"})
-				return
-			}
-		}
-
-		if err := tx.Commit(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
-			return
-		}
-
-		c.JSON(http.StatusOK, gin.H{"message": "Locations assigned successfully"})
-	})
-
-	// Update assignment status
-	router.PUT("/api/teams/:id/assignments/:assignmentId", func(c *gin.Context) {
-		teamID := c.Param("id") // Changed from "teamId" to "id"
-		assignmentID := c.Param("assignmentId")
-		var request struct {
-			IsCompleted bool `json:"is_completed"`
-		}
+	// Team assignments: check territories out to a team and track them
+	// until they are returned or completed
+	router.GET("/api/teams/:id/assignments", controllers.GetTeamAssignments(db))
+	router.POST("/api/teams/:id/assignments", controllers.AssignLocations(db))
+	router.PUT("/api/teams/:id/assignments/:assignmentId", controllers.UpdateAssignment(db))
 
-		if err := c.ShouldBindJSON(&request); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
-			return
-		}
+	// Open assignments past their due date, and the status history of one
+	router.GET("/api/assignments/overdue", controllers.GetOverdueAssignments(db))
+	router.GET("/api/assignments/:id/events", controllers.GetAssignmentEvents(db))
 
-		var completedDate *time.Time
-		if request.IsCompleted {
-			now := time.Now()
-			completedDate = &now
-		}
-
-		_, err := db.Exec(`
-            UPDATE team_assignments 
-            SET is_completed = ?, completed_date = ?
-            WHERE id = ? AND team_id = ?
-        `, request.IsCompleted, completedDate, assignmentID, teamID)
+	// Hand an open assignment to another team
+	router.POST("/api/assignments/:id/transfer", controllers.TransferAssignment(db))
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assignment"})
-			return
-		}
+	// Who has worked a location, and what a team has worked, over time
+	router.GET("/api/locations/:id/assignment-history", controllers.GetLocationAssignmentHistory(db))
+	router.GET("/api/teams/:id/assignment-history", controllers.GetTeamAssignmentHistory(db))
 
-		c.JSON(http.StatusOK, gin.H{"message": "Assignment updated successfully"})
-	})
+	// Application settings such as the default loan period
+	router.GET("/api/settings", controllers.GetSettings(db))
+	router.PUT("/api/settings/:key", controllers.UpdateSetting(db))
 
 	// Get team's planned visits
 	router.GET("/api/teams/:id/planned", func(c *gin.Context) {
@@ -442,15 +329,16 @@ func SetupRoutes(router *gin.Engine, db *sqlx.DB) {
 			LocationID   int    `json:"location_id" db:"location_id"`
 			LocationName string `json:"location_name" db:"name"`
 			PlannedDate  string `json:"planned_date" db:"planned_date"`
+			Sequence     *int   `json:"sequence" db:"sequence"`
 		}
 
 		query := `
-        SELECT l.id as location_id, l.name, pv.planned_date
+        SELECT l.id as location_id, l.name, pv.planned_date, pv.sequence
         FROM planned_visits pv
         JOIN locations l ON pv.location_id = l.id
         WHERE pv.team_id = ?
         AND DATE(pv.planned_date) >= DATE('now')
-        ORDER BY pv.planned_date, l.name
+        ORDER BY pv.planned_date, pv.sequence IS NULL, pv.sequence, l.name
     `
 
 		if err := db.Select(&planned, query, teamID); err != nil {
@@ -461,79 +349,12 @@ func SetupRoutes(router *gin.Engine, db *sqlx.DB) {
 		c.JSON(http.StatusOK, planned)
 	})
 
-	// Add this to your routes.go
-	router.GET("/api/visits/history", func(c *gin.Context) {
-		var visits []struct {
-			ID           int       `json:"id" db:"id"`
-			VisitDate    time.Time `json:"visit_date" db:"visit_date"`
-			TeamName     string    `json:"team_name" db:"team_name"`
-			LocationName string    `json:"location_name" db:"location_name"`
-			IsPreached   bool      `json:"is_preached" db:"is_preached"`
-			Notes        string    `json:"notes" db:"notes"`
-		}
-
-		query := `
-        SELECT 
-            v.id,
-            v.visit_date,
-            t.name as team_name,
-            l.name as location_name,
-            v.is_preached,
-            v.notes
-        FROM location_visits v
-        JOIN teams t ON v.team_id = t.id
-        JOIN locations l ON v.location_id = l.id
-        ORDER BY v.visit_date DESC
-    `
+	// Plan the visiting order for a team's day
+	router.GET("/api/teams/:id/planned/route", controllers.GetPlannedRoute(db))
 
-		if err := db.Select(&visits, query); err != nil {
-			log.Printf("Error fetching visit history: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch visit history"})
-			return
-		}
-
-		c.JSON(http.StatusOK, visits)
-	})
-}
-
-func initializeTables(db *sqlx.DB) {
-	// First create the visits table
-	createVisitsTable := `
-    CREATE TABLE IF NOT EXISTS location_visits (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        location_id INTEGER NOT NULL,
-        team_id INTEGER NOT NULL,
-        visit_date DATETIME NOT NULL,
-        is_preached BOOLEAN NOT NULL DEFAULT FALSE,
-        notes TEXT,
-        FOREIGN KEY(location_id) REFERENCES locations(id),
-        FOREIGN KEY(team_id) REFERENCES teams(id)
-    );`
-
-	_, err := db.Exec(createVisitsTable)
-	if err != nil {
-		log.Printf("Error creating visits table: %v", err)
-	}
-
-	// Check if is_preached column exists in locations table
-	var hasIsPreached bool
-	err = db.Get(&hasIsPreached, `
-        SELECT COUNT(*) > 0 
-        FROM pragma_table_info('locations') 
-        WHERE name='is_preached'
-    `)
-
-	if err != nil {
-		log.Printf("Error checking for is_preached column: %v", err)
-		return
-	}
-
-	// Add the column if it doesn't exist
-	if !hasIsPreached {
-		_, err = db.Exec(`ALTER TABLE locations ADD COLUMN is_preached BOOLEAN DEFAULT FALSE`)
-		if err != nil {
-			log.Printf("Error adding is_preached column: %v", err)
-		}
-	}
+	// Get a team's planned visits for one day as a GPX route
+	router.GET("/api/teams/:id/planned.gpx", controllers.GetPlannedRouteGPX(db))
 
+	// Get every visit, newest first
+	router.GET("/api/visits/history", controllers.GetVisitHistory(db))
 }